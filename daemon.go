@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/internal/feed"
+	"github.com/Necoro/feed2imap-go/internal/feed/cache"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// minimum time between two stores of the cache in daemon mode
+const minSaveInterval = 30 * time.Second
+
+type daemonState struct {
+	state         *cache.State
+	cacheLocation string
+	save          chan struct{}
+	wg            sync.WaitGroup
+	targets       *targetSet
+
+	mu   sync.Mutex               // guards the field below, which is modified on reload
+	wake map[string]chan struct{} // per scheduled feed: wakes it up after a change of the configuration
+}
+
+// jitter returns a random duration of up to a tenth of the interval.
+// It avoids all feeds with the same interval being fetched at the very same moment.
+func jitter(interval time.Duration) time.Duration {
+	if interval < 10 {
+		return 0
+	}
+	return rand.N(interval / 10)
+}
+
+func runDaemon(cfg *config.Config, state *cache.State, cacheLocation string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	state.RemoveDisabled()
+	if state.NumFeeds() == 0 {
+		log.Print("Nothing to do, exiting.")
+		return nil
+	}
+
+	targets := &targetSet{cfg: cfg}
+	if err := targets.connectNew(cfg, usedAccounts(state)); err != nil {
+		return err
+	}
+	defer targets.disconnect()
+
+	d := &daemonState{
+		state:         state,
+		cacheLocation: cacheLocation,
+		save:          make(chan struct{}, 1),
+		targets:       targets,
+		wake:          make(map[string]chan struct{}),
+	}
+
+	log.Printf("Running as daemon with %d feeds.", state.NumFeeds())
+
+	saverDone := make(chan struct{})
+	go func() {
+		d.saver(ctx)
+		close(saverDone)
+	}()
+
+	d.mu.Lock()
+	state.Foreach(func(cf cache.CachedFeed) {
+		d.start(ctx, cf.Feed().Name)
+	})
+	d.mu.Unlock()
+
+	stopReload := reloadOnHangup(state, func(cfg *config.Config, changes cache.Changes) {
+		d.reload(ctx, cfg, changes)
+	})
+
+	<-ctx.Done()
+	stopReload()
+	d.wg.Wait()
+	<-saverDone
+
+	log.Print("Shutting down...")
+
+	if !dryRun {
+		if err := state.StoreCache(cacheLocation); err != nil {
+			return fmt.Errorf("storing cache on shutdown: %w", err)
+		}
+	}
+	return nil
+}
+
+// start schedules the feed with the given name. d.mu must be held.
+func (d *daemonState) start(ctx context.Context, name string) {
+	if _, running := d.wake[name]; running {
+		return
+	}
+
+	wake := make(chan struct{}, 1)
+	d.wake[name] = wake
+	d.wg.Go(func() { d.schedule(ctx, name, wake) })
+}
+
+// acquire returns the feed for its next update. If the feed is gone, it is no longer regarded as scheduled.
+func (d *daemonState) acquire(name string) (cache.CachedFeed, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cf, ok := d.state.Acquire(name)
+	if ok && cf.Gone() {
+		ok = false
+	}
+	if !ok {
+		delete(d.wake, name)
+	}
+	return cf, ok
+}
+
+// schedule runs the updates of a single feed until ctx is done or the feed is removed.
+func (d *daemonState) schedule(ctx context.Context, name string, wake <-chan struct{}) {
+	var (
+		f    *feed.Feed
+		last time.Time
+	)
+
+	for {
+		cf, ok := d.acquire(name)
+		if !ok {
+			log.Printf("Feed %s: No longer scheduled.", name)
+			return
+		}
+
+		if cf.Feed() != f {
+			// initially or after a change of the configuration
+			f = cf.Feed()
+			last = cf.Last()
+		}
+
+		next := f.NextUpdate(last)
+		if !f.HasCronSchedule() {
+			next = next.Add(jitter(f.Interval()))
+		}
+		if backoff := cf.Backoff(); next.Before(backoff) {
+			log.Printf("Feed %s: Failed %d times in a row, backing off until %s.",
+				name, cf.Failures(), backoff.Format(time.DateTime))
+			next = backoff
+		}
+		log.Debugf("Feed %s: Next update at %s", name, next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		last = time.Now()
+		d.update(cf)
+	}
+}
+
+// update fetches a feed and stores its new items.
+func (d *daemonState) update(cf cache.CachedFeed) {
+	if d.state.FetchFeed(cf) && processFeed(cf, d.targets.current()) {
+		d.state.Commit(cf)
+	}
+	d.requestSave()
+}
+
+// reload applies the changes of a reloaded configuration to the schedule.
+func (d *daemonState) reload(ctx context.Context, cfg *config.Config, changes cache.Changes) {
+	_ = d.targets.connectNew(cfg, feedAccounts(cfg, slices.Collect(maps.Keys(cfg.Feeds))))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, name := range slices.Concat(changes.Changed, changes.Removed) {
+		if wake, ok := d.wake[name]; ok {
+			select {
+			case wake <- struct{}{}:
+			default: // already woken up
+			}
+		}
+	}
+
+	for _, name := range slices.Concat(changes.Added, changes.Changed) {
+		if _, ok := d.state.AddFeed(name); ok {
+			d.start(ctx, name)
+		}
+	}
+}
+
+func (d *daemonState) requestSave() {
+	if dryRun {
+		return
+	}
+
+	select {
+	case d.save <- struct{}{}:
+	default: // a store is pending anyhow
+	}
+}
+
+// saver stores the cache on request, but at most once per minSaveInterval.
+func (d *daemonState) saver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.save:
+		}
+
+		if err := d.state.SaveCache(d.cacheLocation); err != nil {
+			log.Errorf("Storing cache: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(minSaveInterval):
+		}
+	}
+}
@@ -43,6 +43,10 @@ type CachedFeed interface {
 	Checked(withFailure bool)
 	// Failures of this feed up to now.
 	Failures() int
+	// Backoff returns the time before which the feed must not be checked again, due to previous failures.
+	Backoff() time.Time
+	// Gone returns whether the feed has been reported as gone by the server. Such feeds are not checked anymore.
+	Gone() bool
 	// The Last time, this feed has been checked
 	Last() time.Time
 	// Filter the given items against the cached items.
@@ -116,10 +120,12 @@ func (cache *Cache) store(fileName string) error {
 		return fmt.Errorf("encoding cache: %w", err)
 	}
 
-	writer.Flush()
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("writing to '%s': %w", fileName, err)
+	}
 	log.Printf("Stored cache to '%s'.", fileName)
 
-	return cache.Unlock()
+	return nil
 }
 
 func (cache *Cache) Unlock() error {
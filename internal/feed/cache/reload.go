@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/Necoro/feed2imap-go/internal/feed"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+// Changes lists the names of the feeds affected by a reload of the configuration.
+type Changes struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// Reload applies a new configuration to the state.
+//
+// Removed feeds are dropped from the state immediately. Changed feeds only switch to their new configuration,
+// when they are acquired for their next fetch. Thus, feeds that are currently processed are not disturbed.
+// Added feeds, and changed feeds that are currently not part of the state, only become part of it through AddFeed.
+// If the new configuration cannot be applied, the state is left untouched.
+func (state *State) Reload(cfg *config.Config) (Changes, error) {
+	newFeeds := make(map[string]*feed.Feed, len(cfg.Feeds))
+	for name, parsedFeed := range cfg.Feeds {
+		f, err := feed.Create(parsedFeed, cfg.GlobalOptions)
+		if err != nil {
+			return Changes{}, err
+		}
+		newFeeds[name] = f
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	var changes Changes
+	globalChanged := !reflect.DeepEqual(state.cfg.GlobalOptions, cfg.GlobalOptions)
+
+	for name, f := range newFeeds {
+		oldFeed, known := state.cfg.Feeds[name]
+		switch {
+		case !known:
+			state.added[name] = f
+			changes.Added = append(changes.Added, name)
+		case globalChanged || !reflect.DeepEqual(oldFeed, f.Feed):
+			if _, active := state.cachedFeeds[name]; active {
+				state.pending[name] = f
+			} else {
+				// e.g., a formerly disabled feed
+				state.added[name] = f
+			}
+			changes.Changed = append(changes.Changed, name)
+		}
+	}
+
+	for name := range state.cfg.Feeds {
+		if _, ok := newFeeds[name]; !ok {
+			delete(state.cachedFeeds, name)
+			delete(state.pending, name)
+			delete(state.added, name)
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+
+	// the cache entries of removed feeds, or of the old version of changed ones, expire from now on
+	state.knownFeeds = make(map[feed.Descriptor]struct{}, len(newFeeds))
+	for _, f := range newFeeds {
+		state.knownFeeds[f.Descriptor()] = struct{}{}
+	}
+
+	slices.Sort(changes.Added)
+	slices.Sort(changes.Changed)
+	slices.Sort(changes.Removed)
+
+	state.cfg = cfg
+	return changes, nil
+}
+
+// Acquire returns the feed with the given name for its next fetch. A pending change of its configuration is applied.
+// Returns false, if the feed is no longer part of the state.
+func (state *State) Acquire(name string) (CachedFeed, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	cf, ok := state.cachedFeeds[name]
+	if !ok {
+		return nil, false
+	}
+
+	if f, ok := state.pending[name]; ok {
+		delete(state.pending, name)
+		if f.Disable {
+			delete(state.cachedFeeds, name)
+			return nil, false
+		}
+
+		cf = state.cache.cachedFeed(f)
+		state.cachedFeeds[name] = cf
+	}
+
+	return cf, true
+}
+
+// AddFeed makes a feed, that has been added (or re-enabled) by Reload, part of the state.
+// Returns false, if there is no such feed or if it is disabled.
+func (state *State) AddFeed(name string) (CachedFeed, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	f, ok := state.added[name]
+	if !ok || f.Disable {
+		return nil, false
+	}
+	delete(state.added, name)
+
+	cf := state.cache.cachedFeed(f)
+	state.cachedFeeds[name] = cf
+	return cf, true
+}
@@ -1,11 +1,15 @@
 package cache
 
 import (
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/Necoro/feed2imap-go/internal/feed"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 	"github.com/Necoro/feed2imap-go/pkg/log"
+	"github.com/Necoro/feed2imap-go/pkg/util"
 )
 
 type State struct {
@@ -14,26 +18,56 @@ type State struct {
 	knownFeeds  map[feed.Descriptor]struct{}
 	cache       Cache
 	cfg         *config.Config
+	pending     map[string]*feed.Feed // changed feeds, waiting for their next fetch
+	added       map[string]*feed.Feed // feeds added by a reload, not yet part of the state
+	mu          sync.Mutex            // guards modifications of the cache when feeds are handled independently
+}
+
+// snapshot returns the current feeds. Iterating over it is safe, even when the state is modified concurrently.
+func (state *State) snapshot() []CachedFeed {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return slices.Collect(maps.Values(state.cachedFeeds))
 }
 
 func (state *State) Foreach(f func(CachedFeed)) {
-	for _, feed := range state.cachedFeeds {
+	for _, feed := range state.snapshot() {
 		f(feed)
 	}
 }
 
 func (state *State) ForeachGo(goFunc func(CachedFeed)) {
+	feeds := state.snapshot()
+
 	var wg sync.WaitGroup
-	wg.Add(len(state.cachedFeeds))
+	for _, feed := range feeds {
+		wg.Go(func() { goFunc(feed) })
+	}
+	wg.Wait()
+}
 
-	f := func(feed CachedFeed, wg *sync.WaitGroup) {
-		goFunc(feed)
-		wg.Done()
+// foreachLimited is like ForeachGo, but uses at most the given number of workers (0 meaning no limit).
+func (state *State) foreachLimited(workers int, goFunc func(CachedFeed)) {
+	feeds := state.snapshot()
+	if workers <= 0 || workers > len(feeds) {
+		workers = len(feeds)
+	}
+
+	queue := make(chan CachedFeed)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for feed := range queue {
+				goFunc(feed)
+			}
+		})
 	}
 
-	for _, feed := range state.cachedFeeds {
-		go f(feed, &wg)
+	for _, feed := range feeds {
+		queue <- feed
 	}
+	close(queue)
 	wg.Wait()
 }
 
@@ -65,7 +99,19 @@ func (state *State) LoadCache(fileName string, forceNew bool) error {
 	return nil
 }
 
+// StoreCache stores the cache and releases the lock on it.
 func (state *State) StoreCache(fileName string) error {
+	if err := state.SaveCache(fileName); err != nil {
+		return err
+	}
+	return state.cache.Unlock()
+}
+
+// SaveCache stores the cache, but keeps it locked.
+func (state *State) SaveCache(fileName string) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
 	state.cache.cleanup(state.knownFeeds)
 	return state.cache.store(fileName)
 }
@@ -74,11 +120,20 @@ func (state *State) UnlockCache() {
 	_ = state.cache.Unlock()
 }
 
+// Fetch fetches all feeds, at most 'max-fetches' at a time.
 func (state *State) Fetch() int {
-	state.ForeachGo(handleFeed)
+	state.mu.Lock()
+	workers := state.cfg.MaxFetches
+	state.mu.Unlock()
+
+	state.foreachLimited(workers, func(cf CachedFeed) {
+		if cf, ok := state.Acquire(cf.Feed().Name); ok {
+			handleFeed(cf)
+		}
+	})
 
 	ctr := 0
-	for _, cf := range state.cachedFeeds {
+	for _, cf := range state.snapshot() {
 		success := cf.Feed().FetchSuccessful()
 		cf.Checked(!success)
 
@@ -90,17 +145,62 @@ func (state *State) Fetch() int {
 	return ctr
 }
 
+// FetchFeed fetches and filters a single feed. It returns whether the fetch has been successful.
+// Contrary to Fetch and Filter, it is safe to be called for different feeds concurrently to each other
+// and to SaveCache.
+func (state *State) FetchFeed(cf CachedFeed) bool {
+	handleFeed(cf)
+	success := cf.Feed().FetchSuccessful()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	cf.Checked(!success)
+	if success {
+		filterFeed(cf)
+	}
+	return success
+}
+
+// Commit commits the changes of a single feed. Like FetchFeed, it is safe to be used concurrently.
+func (state *State) Commit(cf CachedFeed) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	cf.Commit()
+}
+
 func handleFeed(cf CachedFeed) {
 	feed := cf.Feed()
-	log.Printf("Fetching %s from %s", feed.Name, feed.Url)
+	switch {
+	case feed.Redirect() != "":
+		log.Printf("Fetching %s from %s (moved from %s)", feed.Name, feed.Redirect(), feed.SourceUrl())
+	case feed.IsStdin():
+		log.Printf("Reading %s from stdin", feed.Name)
+	case feed.Discovered() != "":
+		log.Printf("Fetching %s from %s (linked from %s)", feed.Name, feed.Discovered(), feed.SourceUrl())
+	default:
+		log.Printf("Fetching %s from %s", feed.Name, feed.SourceUrl())
+	}
 
 	err := feed.Parse()
 	if err != nil {
-		if feed.Url == "" || cf.Failures() >= feed.Global.MaxFailures {
+		if feed.SourceUrl() == "" || cf.Failures() >= feed.Global.MaxFailures {
 			log.Error(err)
 		} else {
 			log.Print(err)
 		}
+	} else if feed.NotModified() {
+		log.Printf("Feed %s has not been modified since last fetch.", feed.Name)
+	}
+
+	if discovered := feed.NewlyDiscovered(); discovered != "" {
+		log.Warnf("Feed %s: '%s' is an HTML page, which links to the feed '%s'. The latter is used from now on, please update the configuration.",
+			feed.Name, feed.SourceUrl(), discovered)
+	}
+	if movedTo := feed.MovedTo(); movedTo != "" && movedTo != feed.Redirect() {
+		log.Warnf("Feed %s has moved permanently from '%s' to '%s'. The new URL is used from now on, please update the configuration.",
+			feed.Name, feed.SourceUrl(), movedTo)
 	}
 }
 
@@ -125,6 +225,8 @@ func NewState(cfg *config.Config) (*State, error) {
 		knownFeeds:  make(map[feed.Descriptor]struct{}, numFeeds),
 		cache:       Cache{}, // loaded later on
 		cfg:         cfg,
+		pending:     map[string]*feed.Feed{},
+		added:       map[string]*feed.Feed{},
 	}
 
 	for name, parsedFeed := range cfg.Feeds {
@@ -139,13 +241,39 @@ func NewState(cfg *config.Config) (*State, error) {
 }
 
 func (state *State) RemoveUndue() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	now := time.Now()
 	for name, feed := range state.cachedFeeds {
-		if feed.Feed().Disable || !feed.Feed().NeedsUpdate(feed.Last()) {
+		switch {
+		case feed.Feed().Disable, feed.Gone():
+			// gone feeds have been reported when detected
+		case now.Before(feed.Backoff()):
+			log.Printf("Feed '%s' failed %d times in a row, backing off until %s.",
+				name, feed.Failures(), util.TimeFormat(feed.Backoff()))
+		case feed.Feed().NeedsUpdate(feed.Last()):
+			continue
+		}
+		delete(state.cachedFeeds, name)
+	}
+}
+
+// RemoveDisabled removes all disabled feeds, but keeps those that are not due yet.
+func (state *State) RemoveDisabled() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	for name, feed := range state.cachedFeeds {
+		if feed.Feed().Disable || feed.Gone() {
 			delete(state.cachedFeeds, name)
 		}
 	}
 }
 
 func (state *State) NumFeeds() int {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
 	return len(state.cachedFeeds)
 }
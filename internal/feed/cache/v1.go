@@ -9,6 +9,7 @@ import (
 	"io"
 	"iter"
 	"maps"
+	nethttp "net/http"
 	"slices"
 	"sort"
 	"strconv"
@@ -18,6 +19,8 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Necoro/feed2imap-go/internal/feed"
+	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 	"github.com/Necoro/feed2imap-go/pkg/util"
 )
@@ -27,6 +30,10 @@ const (
 	startFeedId  uint64  = 1
 	maxCacheSize         = 1000
 	maxCacheDays         = 180
+
+	// backoff after failures: starting with baseBackoff, doubled on each consecutive failure, but capped at maxBackoff
+	baseBackoff = 5 * time.Minute
+	maxBackoff  = 24 * time.Hour
 )
 
 type feedId uint64
@@ -47,13 +54,22 @@ type v1Cache struct {
 }
 
 type cachedFeed struct {
-	feed         *feed.Feed
-	id           feedId // not saved, has to be set on loading
-	LastCheck    time.Time
-	currentCheck time.Time
-	NumFailures  int // can't be named `Failures` b/c it'll collide with the interface
-	Items        []cachedItem
-	newItems     []cachedItem
+	feed          *feed.Feed
+	id            feedId // not saved, has to be set on loading
+	LastCheck     time.Time
+	currentCheck  time.Time
+	NumFailures   int // can't be named `Failures` b/c it'll collide with the interface
+	Items         []cachedItem
+	newItems      []cachedItem
+	ETag          string
+	LastModified  string
+	LastStatus    int       // HTTP status of the last failed check
+	RetryAfter    time.Time // as requested by the server on the last failed check
+	BackoffUntil  time.Time // no check before this time
+	RedirectUrl   string    // the feed has permanently moved here
+	DiscoveredUrl string    // the configured URL points to an HTML page, which links to this feed
+	GoneSince     time.Time // the feed has been reported as gone (410) and is disabled
+	Cookies       []http.SavedCookie
 }
 
 type itemHash [sha256.Size]byte
@@ -70,10 +86,15 @@ type cachedItem struct {
 	UpdatedCache time.Time
 	Hash         itemHash
 	ID           uuid.UUID
+	Location     sink.Location // where the item has been stored, if known
 	deleted      bool
 }
 
 func (item cachedItem) String() string {
+	location := "unknown"
+	if !item.Location.Empty() {
+		location = fmt.Sprintf("%s, UID %d (UIDVALIDITY %d)", item.Location.Folder, item.Location.Uid, item.Location.UidValidity)
+	}
 	return fmt.Sprintf(`{
   ID: %s
   Title: %q
@@ -81,26 +102,86 @@ func (item cachedItem) String() string {
   Link: %q
   Date: %s
   Hash: %s
+  Location: %s
 }`,
 		base64.RawURLEncoding.EncodeToString(item.ID[:]),
-		item.Title, item.Guid, item.Link, util.TimeFormat(item.Date), item.Hash)
+		item.Title, item.Guid, item.Link, util.TimeFormat(item.Date), item.Hash, location)
+}
+
+// backoff returns the time to wait after the given number of consecutive failures.
+func backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	d := baseBackoff
+	for i := 1; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
 }
 
 func (cf *cachedFeed) Checked(withFailure bool) {
 	cf.currentCheck = time.Now()
 	if withFailure {
 		cf.NumFailures++
+		cf.LastStatus, cf.RetryAfter = cf.feed.FetchError()
+		if cf.LastStatus == nethttp.StatusGone && !cf.Gone() {
+			// reported only once, the feed is skipped silently afterwards
+			cf.GoneSince = cf.currentCheck
+			log.Errorf("Feed %s is gone (410) and is disabled from now on. Please remove it from the configuration.", cf.feed.Name)
+		}
+		cf.BackoffUntil = cf.currentCheck.Add(backoff(cf.NumFailures))
+		if cf.RetryAfter.After(cf.BackoffUntil) {
+			cf.BackoffUntil = cf.RetryAfter
+		}
 	} else {
 		cf.NumFailures = 0
+		cf.resetBackoff()
 	}
 }
 
+func (cf *cachedFeed) resetBackoff() {
+	cf.LastStatus = 0
+	cf.RetryAfter = time.Time{}
+	cf.BackoffUntil = time.Time{}
+}
+
+func (cf *cachedFeed) Backoff() time.Time {
+	return cf.BackoffUntil
+}
+
+func (cf *cachedFeed) Gone() bool {
+	return !cf.GoneSince.IsZero()
+}
+
 func (cf *cachedFeed) Commit() {
 	if cf.newItems != nil {
+		locations := cf.feed.Locations()
+		for idx := range cf.newItems {
+			if loc, ok := locations[feed.ItemID(cf.newItems[idx].ID)]; ok {
+				cf.newItems[idx].Location = loc
+			}
+		}
 		cf.Items = cf.newItems
 		cf.newItems = nil
 	}
 	cf.LastCheck = cf.currentCheck
+	cf.Cookies = cf.feed.Cookies()
+	if cf.feed.FetchSuccessful() {
+		cf.ETag, cf.LastModified = cf.feed.Validators()
+		cf.feed.SetValidators(cf.ETag, cf.LastModified)
+		if discovered := cf.feed.NewlyDiscovered(); discovered != "" {
+			cf.DiscoveredUrl = discovered
+			cf.RedirectUrl = "" // the redirect has led to the HTML page, and is not relevant anymore
+			cf.feed.SetDiscovered(discovered)
+			cf.feed.SetRedirect("")
+		}
+		if movedTo := cf.feed.MovedTo(); movedTo != "" {
+			cf.RedirectUrl = movedTo
+			cf.feed.SetRedirect(movedTo)
+		}
+	}
 }
 
 func (cf *cachedFeed) Failures() int {
@@ -159,10 +240,28 @@ func (cache *v1Cache) SpecificInfo(i any) string {
 	b.WriteString(fmt.Sprintf(`
 Last Check: %s
 Num Failures: %d
+Last Status: %d
+Retry-After: %s
+Backoff Until: %s
+Redirected To: %s
+Discovered Feed: %s
+Gone Since: %s
+Cookies: %d
+ETag: %s
+Last-Modified: %s
 Num Items: %d
 `,
 		util.TimeFormat(feed.LastCheck),
 		feed.NumFailures,
+		feed.LastStatus,
+		util.TimeFormat(feed.RetryAfter),
+		util.TimeFormat(feed.BackoffUntil),
+		feed.RedirectUrl,
+		feed.DiscoveredUrl,
+		util.TimeFormat(feed.GoneSince),
+		len(feed.Cookies),
+		feed.ETag,
+		feed.LastModified,
 		len(feed.Items)))
 
 	for _, item := range feed.Items {
@@ -202,6 +301,7 @@ func (cache *v1Cache) getFeed(id feedId) *cachedFeed {
 
 func (cache *v1Cache) cachedFeed(f *feed.Feed) CachedFeed {
 	fDescr := f.Descriptor()
+	urlChanged := false
 	id, ok := cache.Ids[fDescr]
 	if !ok {
 		var otherId feed.Descriptor
@@ -211,6 +311,7 @@ func (cache *v1Cache) cachedFeed(f *feed.Feed) CachedFeed {
 				log.Warnf("Feed %s seems to have changed URLs: new '%s', old '%s'. Updating.",
 					fDescr.Name, fDescr.Url, otherId.Url)
 				changed = true
+				urlChanged = true
 				break
 			} else if otherId.Url == fDescr.Url {
 				log.Warnf("Feed with URL '%s' seems to have changed its name: new '%s', old '%s'. Updating.",
@@ -232,6 +333,19 @@ func (cache *v1Cache) cachedFeed(f *feed.Feed) CachedFeed {
 	cf := cache.getFeed(id)
 	cf.feed = f
 	f.SetExtID(id)
+	if urlChanged {
+		// validators are only valid for the URL they have been received from
+		cf.ETag, cf.LastModified = "", ""
+		// and the new URL deserves a fresh start
+		cf.resetBackoff()
+		cf.RedirectUrl = ""
+		cf.DiscoveredUrl = ""
+		cf.GoneSince = time.Time{}
+	}
+	f.SetValidators(cf.ETag, cf.LastModified)
+	f.SetRedirect(cf.RedirectUrl)
+	f.SetDiscovered(cf.DiscoveredUrl)
+	f.SetCookies(cf.Cookies)
 	return cf
 }
 
@@ -303,6 +417,7 @@ func (cf *cachedFeed) Filter(items []feed.Item, ignoreHash, alwaysNew bool) []fe
 			prevId := cf.Items[oldIdx].ID
 			ci.ID = prevId
 			item.ID = feed.ItemID(prevId)
+			item.Location = cf.Items[oldIdx].Location
 			log.Debugf("oldIdx: %d, prevId: %s, item.id: %s", oldIdx, prevId, item.Id())
 			cf.markItemDeleted(oldIdx)
 		}
@@ -0,0 +1,44 @@
+package feed
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// media types of feeds, as announced in <link rel="alternate"> elements
+var feedTypes = []string{"application/rss+xml", "application/atom+xml", "application/feed+json"}
+
+// discover returns the URL of the first feed linked from the HTML page.
+// Relative links are resolved against base, the URL of the page.
+func discover(page []byte, base *url.URL) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return "", err
+	}
+
+	var found string
+	doc.Find(`link[rel~="alternate"][href]`).EachWithBreak(func(_ int, link *goquery.Selection) bool {
+		typ := strings.ToLower(strings.TrimSpace(link.AttrOr("type", "")))
+		if !slices.Contains(feedTypes, typ) {
+			return true
+		}
+
+		href, err := base.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+		if err != nil {
+			return true
+		}
+
+		found = href.String()
+		return false
+	})
+
+	if found == "" {
+		return "", errors.New("no feed linked")
+	}
+	return found, nil
+}
@@ -0,0 +1,45 @@
+package feed
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	base, _ := url.Parse("https://blog.example.net/posts/")
+
+	tests := []struct {
+		name    string
+		page    string
+		want    string
+		wantErr bool
+	}{
+		{"RSS", `<html><head><link rel="alternate" type="application/rss+xml" href="https://blog.example.net/rss.xml"></head></html>`,
+			"https://blog.example.net/rss.xml", false},
+		{"Relative Atom", `<html><head><link rel="alternate" type="application/atom+xml" href="../atom.xml"></head></html>`,
+			"https://blog.example.net/atom.xml", false},
+		{"JSON Feed", `<link type="application/feed+json" rel="alternate" href="/feed.json">`,
+			"https://blog.example.net/feed.json", false},
+		{"First Feed Wins",
+			`<link rel="stylesheet" type="text/css" href="/style.css">
+			 <link rel="alternate" type="text/html" hreflang="de" href="/de/">
+			 <link rel="alternate" type="application/atom+xml" href="/atom.xml">
+			 <link rel="alternate" type="application/rss+xml" href="/rss.xml">`,
+			"https://blog.example.net/atom.xml", false},
+		{"Multiple Rels", `<link rel="feed alternate" type="Application/RSS+XML" href="/rss.xml">`,
+			"https://blog.example.net/rss.xml", false},
+		{"None", `<html><head><link rel="icon" href="/favicon.ico"></head><body>Hello</body></html>`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := discover([]byte(tt.page), base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("discover() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package feed
 
 import (
 	"fmt"
+	nethttp "net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/Necoro/gofeed"
 
 	"github.com/Necoro/feed2imap-go/internal/feed/filter"
+	"github.com/Necoro/feed2imap-go/internal/feed/jsonapi"
 	"github.com/Necoro/feed2imap-go/internal/http"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 	"github.com/Necoro/feed2imap-go/pkg/log"
@@ -16,11 +18,23 @@ import (
 
 type Feed struct {
 	*config.Feed
-	feed   *gofeed.Feed
-	filter *filter.Filter
-	items  []Item
-	Global config.GlobalOptions
-	extID  FeedID
+	feed            *gofeed.Feed
+	filter          *filter.Filter
+	mapping         *jsonapi.Mapping // for feeds using 'json'
+	preprocessors   []preprocessor
+	jar             *http.CookieJar // nil if cookies are not kept
+	items           []Item
+	Global          config.GlobalOptions
+	extID           FeedID
+	validators      http.Validators // of the last committed fetch
+	fetched         http.Validators // of the current fetch
+	notModified     bool
+	fetchError      http.Error // HTTP error of the current fetch, if any
+	redirect        string     // URL the feed has permanently moved to, known from previous fetches
+	movedTo         string     // URL the feed has permanently moved to, as found out in the current fetch
+	discovered      string     // URL of the feed, if the configured one points to an HTML page; known from previous fetches
+	newlyDiscovered string     // URL of the feed, as discovered in the current fetch
+	schedule        schedule
 }
 
 type FeedID interface {
@@ -36,16 +50,66 @@ type Descriptor struct {
 
 func (feed *Feed) Context() http.Context {
 	return http.Context{
-		Timeout:    feed.Global.Timeout,
-		DisableTLS: feed.NoTLS,
+		Timeout:     feed.Global.Timeout,
+		DisableTLS:  feed.NoTLS,
+		Proxy:       feed.Proxy,
+		TLS:         feed.TLS,
+		Credentials: feed.credentials(),
+		Jar:         feed.jar,
 	}
 }
 
+// credentials returns the configured headers and authentication, bound to the host of the configured URL.
+func (feed *Feed) credentials() *http.Credentials {
+	if len(feed.Headers) == 0 && feed.Auth == (config.Auth{}) {
+		return nil
+	}
+
+	// NB: not the redirect target or discovered URL -- they may point to another host
+	u, err := url.Parse(feed.SourceUrl())
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+
+	header := make(nethttp.Header, len(feed.Headers))
+	for name, value := range feed.Headers {
+		header.Set(name, string(value))
+	}
+
+	return &http.Credentials{
+		Host:     u.Hostname(),
+		Header:   header,
+		User:     feed.Auth.User,
+		Password: string(feed.Auth.Password),
+		Token:    string(feed.Auth.Token),
+	}
+}
+
+// SetCookies restores the cookies of previous fetches. It does nothing for feeds not keeping cookies.
+func (feed *Feed) SetCookies(cookies []http.SavedCookie) {
+	if feed.jar != nil {
+		feed.jar.Load(cookies)
+	}
+}
+
+// Cookies returns the cookies to be kept for the next fetches.
+func (feed *Feed) Cookies() []http.SavedCookie {
+	if feed.jar == nil {
+		return nil
+	}
+	return feed.jar.Saved()
+}
+
 func (feed *Feed) Descriptor() Descriptor {
 	var url string
-	if feed.Url != "" {
+	switch {
+	case feed.Url != "":
 		url = feed.Url
-	} else {
+	case feed.Scrape != nil:
+		url = "scrape://" + feed.Scrape.Url
+	case feed.Json != nil:
+		url = "json://" + feed.Json.Url
+	default:
 		url = "exec://" + strings.Join(feed.Exec, "/")
 	}
 	return Descriptor{
@@ -54,19 +118,133 @@ func (feed *Feed) Descriptor() Descriptor {
 	}
 }
 
+// Interval returns the time between two updates of the feed.
+// If the feed does not specify one, the global interval is used.
+func (feed *Feed) Interval() time.Duration {
+	if feed.MinFreq == 0 {
+		return feed.Global.Interval
+	}
+	return feed.MinFreq.Duration()
+}
+
+// HasCronSchedule returns whether the updates of the feed follow a cron expression instead of an interval.
+func (feed *Feed) HasCronSchedule() bool {
+	return feed.schedule.cron != nil
+}
+
+// NextUpdate returns the time the feed is due again, when it has been updated at updateTime.
+func (feed *Feed) NextUpdate(updateTime time.Time) time.Time {
+	var next time.Time
+	switch {
+	case updateTime.IsZero():
+		next = time.Now()
+	case feed.HasCronSchedule():
+		next = feed.schedule.cron.Next(updateTime)
+	default:
+		next = updateTime.Add(feed.Interval())
+	}
+	return feed.schedule.nextAllowed(next)
+}
+
 func (feed *Feed) NeedsUpdate(updateTime time.Time) bool {
-	if feed.MinFreq == 0 { // shortcut
-		return true
+	now := time.Now()
+	if !feed.schedule.allowed(now) {
+		log.Debugf("Feed '%s' is outside of its fetch windows, skipping.", feed.Name)
+		return false
+	}
+
+	var due bool
+	switch {
+	case updateTime.IsZero():
+		due = true
+	case feed.HasCronSchedule():
+		due = !feed.schedule.cron.Next(updateTime).After(now)
+	default:
+		due = now.Sub(updateTime) >= feed.MinFreq.Duration()
 	}
-	if !updateTime.IsZero() && int(time.Since(updateTime).Hours()) < feed.MinFreq {
+
+	if !due {
 		log.Printf("Feed '%s' does not need updating, skipping.", feed.Name)
-		return false
 	}
-	return true
+	return due
 }
 
 func (feed *Feed) FetchSuccessful() bool {
-	return feed.feed != nil
+	return feed.feed != nil || feed.notModified
+}
+
+// NotModified marks whether the feed has not changed since the last fetch.
+func (feed *Feed) NotModified() bool {
+	return feed.notModified
+}
+
+// FetchError returns the HTTP status and the requested time to retry, if the current fetch failed with an HTTP error.
+func (feed *Feed) FetchError() (status int, retryAfter time.Time) {
+	return feed.fetchError.StatusCode, feed.fetchError.RetryAfter
+}
+
+// SetRedirect sets the URL the feed has permanently moved to. Further fetches use this URL instead of the configured one.
+func (feed *Feed) SetRedirect(url string) {
+	feed.redirect = url
+}
+
+// Redirect returns the URL the feed has permanently moved to, or the empty string.
+func (feed *Feed) Redirect() string {
+	return feed.redirect
+}
+
+// MovedTo returns the URL the current fetch has been permanently redirected to, or the empty string.
+func (feed *Feed) MovedTo() string {
+	return feed.movedTo
+}
+
+// SetDiscovered sets the URL of the feed, that has been found on the HTML page its configured URL points to.
+// Further fetches use this URL instead of the configured one.
+func (feed *Feed) SetDiscovered(url string) {
+	feed.discovered = url
+}
+
+// Discovered returns the URL of the feed, that has been found on the HTML page its configured URL points to.
+func (feed *Feed) Discovered() string {
+	return feed.discovered
+}
+
+// NewlyDiscovered returns the URL of the feed, if the current fetch has found it on an HTML page.
+func (feed *Feed) NewlyDiscovered() string {
+	return feed.newlyDiscovered
+}
+
+func (feed *Feed) fetchUrl() string {
+	switch {
+	case feed.redirect != "":
+		return feed.redirect
+	case feed.discovered != "":
+		return feed.discovered
+	default:
+		return feed.SourceUrl()
+	}
+}
+
+// SourceUrl returns the configured URL the feed is fetched from. It is empty for feeds using 'exec'.
+func (feed *Feed) SourceUrl() string {
+	switch {
+	case feed.Scrape != nil:
+		return feed.Scrape.Url
+	case feed.Json != nil:
+		return feed.Json.Url
+	default:
+		return feed.Url
+	}
+}
+
+// SetValidators sets the HTTP validators (ETag, Last-Modified) of the last successful fetch.
+func (feed *Feed) SetValidators(etag, lastModified string) {
+	feed.validators = http.Validators{ETag: etag, LastModified: lastModified}
+}
+
+// Validators returns the HTTP validators (ETag, Last-Modified) of the current fetch.
+func (feed *Feed) Validators() (etag, lastModified string) {
+	return feed.fetched.ETag, feed.fetched.LastModified
 }
 
 func Create(parsedFeed *config.Feed, global config.GlobalOptions) (*Feed, error) {
@@ -77,7 +255,36 @@ func Create(parsedFeed *config.Feed, global config.GlobalOptions) (*Feed, error)
 			return nil, fmt.Errorf("Feed %s: Parsing item-filter: %w", parsedFeed.Name, err)
 		}
 	}
-	return &Feed{Feed: parsedFeed, Global: global, filter: itemFilter}, nil
+	var mapping *jsonapi.Mapping
+	if parsedFeed.Json != nil {
+		if mapping, err = jsonapi.New(parsedFeed.Json); err != nil {
+			return nil, fmt.Errorf("Feed %s: Parsing json mapping: %w", parsedFeed.Name, err)
+		}
+	}
+	if err = http.ValidateProxy(parsedFeed.Proxy); err != nil {
+		return nil, fmt.Errorf("Feed %s: %w", parsedFeed.Name, err)
+	}
+	preprocessors, err := newPreprocessors(parsedFeed.Preprocess, parsedFeed.PreprocExec)
+	if err != nil {
+		return nil, fmt.Errorf("Feed %s: %w", parsedFeed.Name, err)
+	}
+	sched, err := newSchedule(parsedFeed.Schedule, parsedFeed.FetchWindows)
+	if err != nil {
+		return nil, fmt.Errorf("Feed %s: %w", parsedFeed.Name, err)
+	}
+	var jar *http.CookieJar
+	if parsedFeed.Cookies {
+		jar = http.NewCookieJar()
+	}
+	return &Feed{
+		Feed:          parsedFeed,
+		Global:        global,
+		filter:        itemFilter,
+		mapping:       mapping,
+		preprocessors: preprocessors,
+		jar:           jar,
+		schedule:      sched,
+	}, nil
 }
 
 func (feed *Feed) filterItems() []Item {
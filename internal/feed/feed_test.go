@@ -0,0 +1,42 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func TestCredentialsHost(t *testing.T) {
+	tests := []struct {
+		name       string
+		redirect   string
+		discovered string
+	}{
+		{"Configured", "", ""},
+		{"Redirect", "https://elsewhere.example.org/feed.xml", ""},
+		{"Redirect same host", "https://feeds.example.net/moved.xml", ""},
+		{"Discovered", "", "https://elsewhere.example.org/rss.xml"},
+		{"Both", "https://elsewhere.example.org/feed.xml", "https://other.example.com/rss.xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Feed{Feed: &config.Feed{
+				Url: "https://feeds.example.net/feed.xml",
+				Options: config.Options{
+					Headers: config.Headers{"X-Api-Key": "secret"},
+					Auth:    config.Auth{User: "user", Password: "password"},
+				},
+			}}
+			f.SetRedirect(tt.redirect)
+			f.SetDiscovered(tt.discovered)
+
+			creds := f.credentials()
+			if creds == nil {
+				t.Fatal("No credentials")
+			}
+			if creds.Host != "feeds.example.net" {
+				t.Errorf("Credentials bound to %q, want the configured host", creds.Host)
+			}
+		})
+	}
+}
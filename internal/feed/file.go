@@ -0,0 +1,115 @@
+package feed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Necoro/gofeed"
+
+	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// stdin can only be read once per process
+var stdin struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+// parseStdin parses the feed from stdin. As there is nothing more to read afterwards,
+// later fetches are reported as not modified.
+func (feed *Feed) parseStdin() (*gofeed.Feed, error) {
+	first := false
+	stdin.once.Do(func() {
+		first = true
+		stdin.body, stdin.err = io.ReadAll(os.Stdin)
+	})
+
+	if !first {
+		feed.notModified = true
+		return nil, nil
+	}
+	if stdin.err != nil {
+		return nil, fmt.Errorf("reading feed '%s' from stdin: %w", feed.Name, stdin.err)
+	}
+
+	body, err := feed.preprocess(stdin.body)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedFeed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing feed '%s': %w", feed.Name, err)
+	}
+	return parsedFeed, nil
+}
+
+// fileState sums up name, size, and modification time of the files. It serves as ETag for local files.
+func fileState(files []string) (string, error) {
+	h := sha256.New()
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00%d\x00", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseFiles parses the local files matched by the feed's path. The items of all files are merged into one feed,
+// whose other attributes are taken from the first file.
+func (feed *Feed) parseFiles() (*gofeed.Feed, error) {
+	pattern, _ := feed.FilePattern()
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("feed '%s': %w", feed.Name, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("feed '%s': No file matches '%s'", feed.Name, pattern)
+	}
+
+	state, err := fileState(files)
+	if err != nil {
+		return nil, fmt.Errorf("feed '%s': %w", feed.Name, err)
+	}
+	if state == feed.validators.ETag {
+		feed.notModified = true
+		feed.fetched = feed.validators
+		return nil, nil
+	}
+
+	fp := gofeed.NewParser()
+	var parsedFeed *gofeed.Feed
+	for _, file := range files {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("feed '%s': %w", feed.Name, err)
+		}
+		if body, err = feed.preprocess(body); err != nil {
+			return nil, err
+		}
+		fileFeed, err := fp.Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("parsing file '%s' of feed '%s': %w", file, feed.Name, err)
+		}
+
+		log.Debugf("Feed %s: Read %d items from '%s'.", feed.Name, len(fileFeed.Items), file)
+		if parsedFeed == nil {
+			parsedFeed = fileFeed
+		} else {
+			parsedFeed.Items = append(parsedFeed.Items, fileFeed.Items...)
+		}
+	}
+
+	feed.fetched = http.Validators{ETag: state}
+	return parsedFeed, nil
+}
@@ -0,0 +1,82 @@
+package feed
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func writeFeed(t *testing.T, path, title string) {
+	t.Helper()
+	content := []byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>` + title +
+		`</title><item><title>Item of ` + title + `</title></item></channel></rss>`)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFeed(t, filepath.Join(dir, "a.xml"), "A")
+	writeFeed(t, filepath.Join(dir, "b.xml"), "B")
+	writeFeed(t, filepath.Join(dir, "c.txt"), "C")
+
+	f, err := Create(&config.Feed{Name: "Files", Url: "file://" + filepath.Join(dir, "*.xml")}, config.GlobalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := func() []string {
+		var res []string
+		for _, item := range f.items {
+			res = append(res, item.Title)
+		}
+		return res
+	}
+
+	if err = f.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if f.feed.Title != "A" {
+		t.Errorf("Unexpected feed title %q", f.feed.Title)
+	}
+	if diff := cmp.Diff([]string{"Item of A", "Item of B"}, titles()); diff != "" {
+		t.Error(diff)
+	}
+
+	// unchanged files
+	f.SetValidators(f.Validators())
+	if err = f.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if !f.NotModified() {
+		t.Error("Unchanged files should not be modified")
+	}
+
+	// a changed file
+	writeFeed(t, filepath.Join(dir, "b.xml"), "B2")
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(filepath.Join(dir, "b.xml"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	if f.NotModified() {
+		t.Error("Changed files should be modified")
+	}
+	if diff := cmp.Diff([]string{"Item of A", "Item of B2"}, titles()); diff != "" {
+		t.Error(diff)
+	}
+
+	// no match
+	f, _ = Create(&config.Feed{Name: "None", Url: "file://" + filepath.Join(dir, "*.json")}, config.GlobalOptions{})
+	if err = f.Parse(); err == nil {
+		t.Error("Expected an error for a pattern without matches")
+	}
+}
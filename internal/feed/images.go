@@ -0,0 +1,328 @@
+package feed
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+
+	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+const (
+	// maximum size of all images kept in memory
+	imageMemoryLimit = 64 << 20
+	// images are kept in memory for this long; afterwards they are taken from (and revalidated by) the disk cache again.
+	// This matters for long-running processes, i.e. daemon mode.
+	imageMemoryTTL = 30 * time.Minute
+	// images without validators are reused from the disk cache for this long, without asking the server
+	imageFreshness = 24 * time.Hour
+	// images unused for this long are removed from the disk cache
+	imageExpiry = 30 * 24 * time.Hour
+)
+
+// image is a downloaded image.
+type image struct {
+	data []byte
+	mime string
+}
+
+// memImage is an entry of the in-memory cache. Until done is closed, the image is still being downloaded.
+type memImage struct {
+	image
+	done    chan struct{}
+	err     error
+	elem    *list.Element
+	fetched time.Time
+}
+
+// imageCache keeps the recently used images in memory, so that each image is only downloaded once per run,
+// even if it is requested concurrently. The least recently used images are dropped when the limit is exceeded,
+// and all of them after the ttl.
+type imageCache struct {
+	mu      sync.Mutex
+	entries map[string]*memImage
+	lru     list.List // keys of the finished downloads, most recently used first
+	size    int
+	limit   int
+	ttl     time.Duration
+}
+
+func newImageCache(limit int, ttl time.Duration) *imageCache {
+	return &imageCache{
+		entries: make(map[string]*memImage),
+		limit:   limit,
+		ttl:     ttl,
+	}
+}
+
+var images = newImageCache(imageMemoryLimit, imageMemoryTTL)
+
+// remove drops the finished download of the key. The lock must be held.
+func (c *imageCache) remove(key string) {
+	e := c.entries[key]
+	c.lru.Remove(e.elem)
+	c.size -= len(e.data)
+	delete(c.entries, key)
+}
+
+// get returns the image of the key, calling fetch if it is neither cached nor currently downloaded.
+// Failed downloads are not cached.
+func (c *imageCache) get(key string, fetch func() (image, error)) (image, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		if e.elem == nil || time.Since(e.fetched) < c.ttl {
+			if e.elem != nil {
+				c.lru.MoveToFront(e.elem)
+			}
+			c.mu.Unlock()
+			<-e.done
+			return e.image, e.err
+		}
+		c.remove(key)
+	}
+
+	e := &memImage{done: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.image, e.err = fetch()
+	close(e.done)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e.err != nil || len(e.data) > c.limit {
+		delete(c.entries, key)
+		return e.image, e.err
+	}
+
+	e.elem = c.lru.PushFront(key)
+	e.fetched = time.Now()
+	c.size += len(e.data)
+	for c.size > c.limit {
+		c.remove(c.lru.Back().Value.(string))
+	}
+
+	return e.image, e.err
+}
+
+// diskImage is an image as stored in the on-disk cache.
+type diskImage struct {
+	Url        string // the cache key, see http.Context.CacheKey
+	Mime       string
+	Data       []byte
+	Validators http.Validators
+	Fetched    time.Time
+}
+
+// imageDir is the on-disk cache of images, one file per cache key. An empty imageDir disables the cache.
+type imageDir string
+
+// pruned records the directories already cleaned up in this process.
+var pruned sync.Map
+
+func (dir imageDir) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(string(dir), hex.EncodeToString(sum[:]))
+}
+
+// load returns the cached image of the key, or nil if there is none.
+func (dir imageDir) load(key string) *diskImage {
+	if dir == "" {
+		return nil
+	}
+	if _, done := pruned.LoadOrStore(dir, true); !done {
+		dir.prune(time.Now().Add(-imageExpiry))
+	}
+
+	file := dir.file(key)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Reading image cache: %s", err)
+		}
+		return nil
+	}
+
+	var img diskImage
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&img); err != nil || img.Url != key {
+		log.Warnf("Ignoring broken image cache entry '%s'", file)
+		return nil
+	}
+
+	// mark as used for pruning
+	now := time.Now()
+	_ = os.Chtimes(file, now, now)
+
+	return &img
+}
+
+// store saves the image in the cache. Errors are only logged, as the cache is merely an optimization.
+func (dir imageDir) store(img *diskImage) {
+	if dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(string(dir), 0700); err != nil {
+		log.Warnf("Creating image cache: %s", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(img); err != nil {
+		log.Warnf("Encoding image for cache: %s", err)
+		return
+	}
+
+	// write to a temporary file first, so that concurrent readers never see partial entries
+	file := dir.file(img.Url)
+	tmp, err := os.CreateTemp(string(dir), ".tmp-*")
+	if err != nil {
+		log.Warnf("Writing image cache: %s", err)
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		log.Warnf("Writing image cache: %s", err)
+	}
+}
+
+// prune removes all entries not used since the given time.
+func (dir imageDir) prune(since time.Time) {
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Pruning image cache: %s", err)
+		}
+		return
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !info.ModTime().Before(since) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(string(dir), entry.Name())); err == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Debugf("Removed %d expired images from cache '%s'", removed, dir)
+	}
+}
+
+func imageMime(src string, img []byte) string {
+	if ext := path.Ext(src); ext != "" {
+		if mimeStr := mime.TypeByExtension(ext); mimeStr != "" {
+			return mimeStr
+		}
+	}
+	return mimetype.Detect(img).String()
+}
+
+// getImage downloads the image, using the on-disk cache (with the given key) if possible.
+func getImage(src, key string, ctx http.Context, dir imageDir) (image, error) {
+	cached := dir.load(key)
+	var validators http.Validators
+	if cached != nil {
+		if cached.Validators.Empty() {
+			if time.Since(cached.Fetched) < imageFreshness {
+				return image{cached.Data, cached.Mime}, nil
+			}
+		} else {
+			validators = cached.Validators
+		}
+	}
+
+	resp, cancel, err := http.GetConditional(src, ctx, validators)
+	if errors.Is(err, http.ErrNotModified) {
+		log.Debugf("Image '%s' not modified, using cached version", src)
+		return image{cached.Data, cached.Mime}, nil
+	}
+	if err != nil {
+		return image{}, fmt.Errorf("fetching from '%s': %w", src, err)
+	}
+	defer cancel()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return image{}, fmt.Errorf("reading from '%s': %w", src, err)
+	}
+
+	img := image{data, imageMime(src, data)}
+	dir.store(&diskImage{
+		Url:        key,
+		Mime:       img.mime,
+		Data:       img.data,
+		Validators: http.ValidatorsOf(resp),
+		Fetched:    time.Now(),
+	})
+	return img, nil
+}
+
+// fetchImages downloads the images concurrently. Each URL is downloaded only once per run,
+// unless the request depends on the feed (see http.Context.CacheKey).
+// Images that could not be fetched are reported and left empty.
+func (item *Item) fetchImages(urls []string) []image {
+	feed := item.feed
+	ctx := feed.Context()
+	dir := imageDir(feed.Global.ImageCache)
+
+	res := make([]image, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Go(func() {
+			var (
+				img image
+				err error
+			)
+			if key, shared := ctx.CacheKey(url); shared {
+				img, err = images.get(key, func() (image, error) {
+					return getImage(url, key, ctx, dir)
+				})
+			} else {
+				// sent with cookies: neither cached in memory nor on disk
+				img, err = getImage(url, "", ctx, "")
+			}
+			if err != nil {
+				log.Errorf("Feed %s: Item %s: Error fetching image: %s", feed.Name, item.Link, err)
+				return
+			}
+			res[i] = img
+		})
+	}
+	wg.Wait()
+	return res
+}
+
+// imageName derives the filename of the attached image from its source.
+func imageName(src string) string {
+	name := path.Base(src)
+	if name == "/" || name == "." || strings.TrimSpace(name) == "" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,193 @@
+package feed
+
+import (
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Necoro/gofeed"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func TestImageCache(t *testing.T) {
+	c := newImageCache(10, time.Hour)
+	var calls atomic.Int32
+	fetch := func(data string) func() (image, error) {
+		return func() (image, error) {
+			calls.Add(1)
+			return image{[]byte(data), "image/png"}, nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			img, err := c.get("a", fetch("aaaa"))
+			if err != nil || string(img.data) != "aaaa" {
+				t.Errorf("Unexpected result %q, %v", img.data, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected one download, got %d", n)
+	}
+
+	// exceeds the limit together with "a", which is then dropped
+	_, _ = c.get("b", fetch("bbbbbbbb"))
+	_, _ = c.get("b", fetch("bbbbbbbb"))
+	_, _ = c.get("a", fetch("aaaa"))
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected three downloads, got %d", n)
+	}
+	if c.size != 4 || len(c.entries) != 1 {
+		t.Errorf("Unexpected cache state: size %d, %d entries", c.size, len(c.entries))
+	}
+}
+
+func TestImageCacheExpiry(t *testing.T) {
+	c := newImageCache(100, 20*time.Millisecond)
+	var calls int
+	fetch := func() (image, error) {
+		calls++
+		return image{[]byte("aaaa"), "image/png"}, nil
+	}
+
+	_, _ = c.get("a", fetch)
+	_, _ = c.get("a", fetch)
+	if calls != 1 {
+		t.Fatalf("Expected one download, got %d", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if img, err := c.get("a", fetch); err != nil || string(img.data) != "aaaa" {
+		t.Errorf("Unexpected result %q, %v", img.data, err)
+	}
+	if calls != 2 {
+		t.Errorf("Expired image not downloaded again, got %d downloads", calls)
+	}
+	if c.size != 4 || len(c.entries) != 1 || c.lru.Len() != 1 {
+		t.Errorf("Unexpected cache state: size %d, %d entries", c.size, len(c.entries))
+	}
+}
+
+// imageServer serves the same image for every path and counts the full and the conditional responses.
+func imageServer(t *testing.T) (srv *httptest.Server, full, notModified *atomic.Int32) {
+	full, notModified = new(atomic.Int32), new(atomic.Int32)
+	srv = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(nethttp.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("GIF89a-image"))
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+func TestGetImageRevalidates(t *testing.T) {
+	srv, full, notModified := imageServer(t)
+	dir := imageDir(t.TempDir())
+	url := srv.URL + "/logo.gif"
+
+	for range 2 {
+		img, err := getImage(url, url, http.Context{Timeout: 5}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(image{[]byte("GIF89a-image"), "image/gif"}, img, cmp.AllowUnexported(image{})); diff != "" {
+			t.Error(diff)
+		}
+	}
+
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("Expected one download and one revalidation, got %d and %d", full.Load(), notModified.Load())
+	}
+}
+
+func TestBuildBodyDedupesImages(t *testing.T) {
+	images = newImageCache(imageMemoryLimit, imageMemoryTTL)
+	srv, full, _ := imageServer(t)
+
+	f, err := Create(&config.Feed{Name: "Images", Url: srv.URL, Options: config.DefaultFeedOptions}, config.DefaultGlobalOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.feed = &gofeed.Feed{}
+
+	newItem := func() *Item {
+		return &Item{
+			Item: &gofeed.Item{Content: `<p><img src="/logo.gif"><img src="logo.gif" srcset="big.gif 2x"><img src="/other.gif"></p>`},
+			Feed: f.feed,
+			feed: f,
+		}
+	}
+
+	item := newItem()
+	item.buildBody()
+	if n := len(item.images); n != 2 {
+		t.Errorf("Expected 2 attached images, got %d", n)
+	}
+	if c := strings.Count(item.Body, `src="cid:cid_1"`); c != 2 {
+		t.Errorf("Expected the first image to be referenced twice, got %d: %s", c, item.Body)
+	}
+	if !strings.Contains(item.Body, `src="cid:cid_2"`) || strings.Contains(item.Body, "srcset") {
+		t.Errorf("Unexpected body: %s", item.Body)
+	}
+
+	// a second item with the same images does not download them again
+	newItem().buildBody()
+	if n := full.Load(); n != 2 {
+		t.Errorf("Expected 2 downloads, got %d", n)
+	}
+}
+
+func TestFetchImagesCredentials(t *testing.T) {
+	images = newImageCache(imageMemoryLimit, imageMemoryTTL)
+	var downloads atomic.Int32
+	srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		downloads.Add(1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("GIF89a-private"))
+	}))
+	t.Cleanup(srv.Close)
+
+	global := config.DefaultGlobalOptions
+	global.ImageCache = t.TempDir()
+
+	newFeed := func(name string, auth config.Auth) *Feed {
+		opts := config.DefaultFeedOptions
+		opts.Auth = auth
+		f, err := Create(&config.Feed{Name: name, Url: srv.URL + "/feed", Options: opts}, global)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	private := newFeed("Private", config.Auth{Token: "secret"})
+	public := newFeed("Public", config.Auth{})
+
+	url := srv.URL + "/logo.gif"
+	if img := (&Item{Item: &gofeed.Item{}, feed: private}).fetchImages([]string{url})[0]; string(img.data) != "GIF89a-private" {
+		t.Fatalf("Expected the private image, got %q", img.data)
+	}
+	if img := (&Item{Item: &gofeed.Item{}, feed: public}).fetchImages([]string{url})[0]; img.data != nil {
+		t.Errorf("Expected no image without credentials, got %q", img.data)
+	}
+	if n := downloads.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/Necoro/gofeed"
 	"github.com/google/uuid"
 
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 )
 
@@ -36,6 +37,7 @@ type Item struct {
 	ID           ItemID
 	reasons      []string
 	images       []feedImage
+	Location     sink.Location // where the previous version of this item has been stored
 }
 
 func (item *Item) DateParsed() *time.Time {
@@ -0,0 +1,215 @@
+// Package jsonapi maps arbitrary JSON documents onto feed items, using expressions for the single fields.
+package jsonapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Necoro/gofeed"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/itlightning/dateparse"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+type Mapping struct {
+	items   *vm.Program
+	title   *vm.Program
+	link    *vm.Program
+	guid    *vm.Program
+	date    *vm.Program
+	content *vm.Program
+	authors *vm.Program
+}
+
+func compile(field, s, dflt string) (*vm.Program, error) {
+	if s == "" {
+		if dflt == "" {
+			return nil, nil
+		}
+		s = dflt
+	}
+	// the JSON is untyped, hence we cannot check the names used
+	prog, err := expr.Compile(s, expr.AllowUndefinedVariables())
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", field, err)
+	}
+	return prog, nil
+}
+
+func New(cfg *config.JsonApi) (*Mapping, error) {
+	m := &Mapping{}
+	var err error
+
+	fields := []struct {
+		prog        **vm.Program
+		name, value string
+		dflt        string
+	}{
+		{&m.items, "items", cfg.Items, "$env"},
+		{&m.title, "title", cfg.Title, "title"},
+		{&m.link, "link", cfg.Link, "link"},
+		{&m.guid, "guid", cfg.Guid, "id"},
+		{&m.date, "date", cfg.Date, "date"},
+		{&m.content, "content", cfg.Content, "content"},
+		{&m.authors, "authors", cfg.Authors, ""},
+	}
+
+	for _, f := range fields {
+		if *f.prog, err = compile(f.name, f.value, f.dflt); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Parse decodes the JSON document and maps the selected elements onto items.
+// Elements that have neither a title nor a link are skipped.
+func (m *Mapping) Parse(data []byte) ([]*gofeed.Item, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	res, err := expr.Run(m.items, doc)
+	if err != nil {
+		return nil, fmt.Errorf("'items': %w", err)
+	}
+	elements, ok := res.([]any)
+	if !ok {
+		return nil, fmt.Errorf("'items' yields %T instead of an array", res)
+	}
+
+	items := make([]*gofeed.Item, 0, len(elements))
+	for idx, elem := range elements {
+		item, err := m.item(elem)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", idx, err)
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *Mapping) item(elem any) (*gofeed.Item, error) {
+	var err error
+	run := func(field string, prog *vm.Program) any {
+		if prog == nil || err != nil {
+			return nil
+		}
+		var res any
+		if res, err = expr.Run(prog, elem); err != nil {
+			err = fmt.Errorf("'%s': %w", field, err)
+		}
+		return res
+	}
+
+	item := &gofeed.Item{
+		Title:   toString(run("title", m.title)),
+		Link:    toString(run("link", m.link)),
+		GUID:    toString(run("guid", m.guid)),
+		Content: toString(run("content", m.content)),
+		Authors: toPersons(run("authors", m.authors)),
+	}
+	date := run("date", m.date)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Title == "" && item.Link == "" {
+		return nil, nil
+	}
+
+	if item.Link != "" {
+		item.Links = []string{item.Link}
+	}
+	if len(item.Authors) > 0 {
+		item.Author = item.Authors[0]
+	}
+	if t := toTime(date); !t.IsZero() {
+		item.Published = t.Format(time.RFC3339)
+		item.PublishedParsed = &t
+	}
+
+	if item.GUID == "" {
+		if item.Link != "" {
+			item.GUID = item.Link
+		} else {
+			sum := sha256.Sum256([]byte(item.Title))
+			item.GUID = "json:" + hex.EncodeToString(sum[:])
+		}
+	}
+
+	return item, nil
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		// JSON numbers are floats; do not print IDs in exponent notation
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// toTime converts strings in (almost) any format and numbers (UNIX timestamps in seconds) into a time.
+func toTime(v any) time.Time {
+	switch v := v.(type) {
+	case time.Time:
+		return v
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	case int:
+		return time.Unix(int64(v), 0)
+	case string:
+		if t, err := dateparse.ParseLocal(strings.TrimSpace(v)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func toPerson(v any) *gofeed.Person {
+	switch v := v.(type) {
+	case map[string]any:
+		p := &gofeed.Person{Name: toString(v["name"]), Email: toString(v["email"])}
+		if p.Name != "" || p.Email != "" {
+			return p
+		}
+	default:
+		if name := toString(v); name != "" {
+			return &gofeed.Person{Name: name}
+		}
+	}
+	return nil
+}
+
+func toPersons(v any) []*gofeed.Person {
+	list, ok := v.([]any)
+	if !ok {
+		list = []any{v}
+	}
+
+	var persons []*gofeed.Person
+	for _, elem := range list {
+		if p := toPerson(elem); p != nil {
+			persons = append(persons, p)
+		}
+	}
+	return persons
+}
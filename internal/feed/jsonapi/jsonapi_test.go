@@ -0,0 +1,92 @@
+package jsonapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Necoro/gofeed"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+const document = `{
+  "data": {
+    "posts": [
+      {"id": 12345678, "title": " First ", "slug": "first", "date": "2024-01-02T10:00:00Z",
+       "body": "<p>Hello</p>", "author": {"name": "Jane", "email": "jane@example.net"}},
+      {"id": 2, "title": "Second", "slug": "second", "created": 1704276000, "tags": ["Foo", "Bar"]},
+      {"slug": "nothing"}
+    ]
+  }
+}`
+
+func date(t time.Time) *time.Time {
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	first := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	second := time.Unix(1704276000, 0)
+
+	tests := []struct {
+		name    string
+		mapping config.JsonApi
+		data    string
+		want    []*gofeed.Item
+		wantErr bool
+	}{
+		{name: "Defaults", data: `[{"title": "T", "link": "https://example.net/t", "content": "C", "date": "2024-01-02T10:00:00Z"}]`,
+			want: []*gofeed.Item{{Title: "T", Link: "https://example.net/t", Links: []string{"https://example.net/t"},
+				GUID: "https://example.net/t", Content: "C", Published: "2024-01-02T10:00:00Z", PublishedParsed: &first}},
+		},
+		{name: "Mapping", data: document, mapping: config.JsonApi{
+			Items:   "data.posts",
+			Link:    "'https://example.net/' + slug",
+			Guid:    "id",
+			Date:    "date ?? created",
+			Content: "body",
+			Authors: "author ?? tags",
+		}, want: []*gofeed.Item{
+			{Title: "First", Link: "https://example.net/first", Links: []string{"https://example.net/first"},
+				GUID: "12345678", Content: "<p>Hello</p>", Published: "2024-01-02T10:00:00Z", PublishedParsed: &first,
+				Author:  &gofeed.Person{Name: "Jane", Email: "jane@example.net"},
+				Authors: []*gofeed.Person{{Name: "Jane", Email: "jane@example.net"}}},
+			{Title: "Second", Link: "https://example.net/second", Links: []string{"https://example.net/second"},
+				GUID: "2", Published: second.Format(time.RFC3339), PublishedParsed: date(second),
+				Author:  &gofeed.Person{Name: "Foo"},
+				Authors: []*gofeed.Person{{Name: "Foo"}, {Name: "Bar"}}},
+			{Title: "", Link: "https://example.net/nothing", Links: []string{"https://example.net/nothing"},
+				GUID: "https://example.net/nothing"},
+		}},
+		{name: "No link", data: `[{"title": "T"}, {}]`, want: []*gofeed.Item{
+			{Title: "T", GUID: "json:e632b7095b0bf32c260fa4c539e9fd7b852d0de454e9be26f24d0d6f91d069d3"},
+		}},
+		{name: "No array", data: `{"title": "T"}`, wantErr: true},
+		{name: "Invalid JSON", data: `[{"title": }]`, wantErr: true},
+		{name: "Runtime error", data: `[{"title": "T"}]`, mapping: config.JsonApi{Link: "title + id"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(&tt.mapping)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			got, err := m.Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); !tt.wantErr && diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(&config.JsonApi{Title: "title +"}); err == nil {
+		t.Error("New() should fail on an invalid expression")
+	}
+}
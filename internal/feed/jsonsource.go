@@ -0,0 +1,35 @@
+package feed
+
+import (
+	"fmt"
+
+	"github.com/Necoro/gofeed"
+
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// fetchJson fetches the JSON document of the feed and maps its elements onto items.
+func (feed *Feed) fetchJson() (*gofeed.Feed, error) {
+	apiUrl := feed.fetchUrl()
+	body, resp, err := feed.get(apiUrl, feed.validators)
+	if err != nil || feed.notModified {
+		return nil, err
+	}
+
+	items, err := feed.mapping.Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("mapping JSON of feed '%s': %w", feed.Name, err)
+	}
+
+	if len(items) == 0 {
+		log.Warnf("Feed %s: No items found in the JSON from '%s'.", feed.Name, apiUrl)
+	}
+
+	return &gofeed.Feed{
+		Title:    feed.Name,
+		Link:     resp.Request.URL.String(),
+		FeedLink: resp.Request.URL.String(),
+		FeedType: "json-api",
+		Items:    items,
+	}, nil
+}
@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
-	"io"
-	"mime"
 	"net/url"
-	"path"
 	"strings"
+	"sync"
 	"time"
 
 	readability "codeberg.org/readeck/go-readability/v2"
@@ -18,13 +16,13 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/emersion/go-message"
 	"github.com/emersion/go-message/mail"
-	"github.com/gabriel-vasile/mimetype"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/charset"
 
 	"github.com/Necoro/feed2imap-go/internal/feed/template"
 	"github.com/Necoro/feed2imap-go/internal/http"
 	"github.com/Necoro/feed2imap-go/internal/msg"
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 	"github.com/Necoro/feed2imap-go/pkg/rfc822"
@@ -211,44 +209,56 @@ func (item *Item) message() (msg.Message, error) {
 		Content:  b.String(),
 		IsUpdate: item.UpdateOnly,
 		ID:       item.Id(),
+		Location: item.Location,
 	}
 
 	return msg, nil
 }
 
+// maximum number of items of a feed processed concurrently. An item downloads at most one article,
+// so this is where articles are fetched in parallel. The HTTP limits per host still apply.
+const maxConcurrentItems = 4
+
 func (feed *Feed) Messages() (msg.Messages, error) {
 	var (
-		err   error
 		mails = make([]msg.Message, len(feed.items))
+		errs  = make([]error, len(feed.items))
+		sem   = make(chan struct{}, maxConcurrentItems)
+		wg    sync.WaitGroup
 	)
+	// the items are independent of each other; fetching their articles and images dominates.
+	// Images shared between items are still downloaded once, see imageCache.
 	for idx := range feed.items {
-		if mails[idx], err = feed.items[idx].message(); err != nil {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			mails[idx], errs[idx] = feed.items[idx].message()
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
 			return nil, fmt.Errorf("creating mails for %s: %w", feed.Name, err)
 		}
 	}
 	return mails, nil
 }
 
-func getImage(src string, ctx http.Context) ([]byte, string, error) {
-	resp, cancel, err := http.Get(src, ctx)
-	if err != nil {
-		return nil, "", fmt.Errorf("fetching from '%s': %w", src, err)
-	}
-	defer cancel()
-
-	img, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", fmt.Errorf("reading from '%s': %w", src, err)
+// SetLocations records where the messages created by Messages have been stored.
+func (feed *Feed) SetLocations(mails msg.Messages) {
+	for idx := range feed.items {
+		feed.items[idx].Location = mails[idx].Location
 	}
+}
 
-	var mimeStr string
-	ext := path.Ext(src)
-	if ext == "" {
-		mimeStr = mimetype.Detect(img).String()
-	} else {
-		mimeStr = mime.TypeByExtension(ext)
+// Locations returns the locations of the stored items.
+func (feed *Feed) Locations() map[ItemID]sink.Location {
+	locations := make(map[ItemID]sink.Location, len(feed.items))
+	for _, item := range feed.items {
+		locations[item.ID] = item.Location
 	}
-	return img, mimeStr, nil
+	return locations
 }
 
 func getFullArticle(src string, ctx http.Context) (string, error) {
@@ -324,32 +334,12 @@ func (item *Item) resolveUrl(otherUrlStr string) string {
 	return feedUrl.ResolveReference(otherUrl).String()
 }
 
-func (item *Item) downloadImage(src string) string {
-	feed := item.feed
-
-	imgUrl := item.resolveUrl(src)
-
-	img, mime, err := getImage(imgUrl, feed.Context())
-	if err != nil {
-		log.Errorf("Feed %s: Item %s: Error fetching image: %s",
-			feed.Name, item.Link, err)
-		return ""
-	}
-	if img == nil {
-		return ""
-	}
-
-	if feed.EmbedImages {
-		return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(img)
-	} else {
-		name := path.Base(src)
-		if name == "/" || name == "." || name == " " {
-			name = ""
-		}
-
-		idx := item.addImage(img, mime, name)
-		return "cid:" + cidNr(idx)
+// imageSrc returns the new source of the image: Either a data URL or a reference to the attached part.
+func (item *Item) imageSrc(img image, name string) string {
+	if item.feed.EmbedImages {
+		return "data:" + img.mime + ";base64," + base64.StdEncoding.EncodeToString(img.data)
 	}
+	return "cid:" + cidNr(item.addImage(img.data, img.mime, name))
 }
 
 func (item *Item) buildBody() {
@@ -416,17 +406,48 @@ func (item *Item) buildBody() {
 	}
 
 	// download images
-	doc.Find("img").Each(func(i int, selection *goquery.Selection) {
-		const attr = "src"
+	var (
+		imgs    = doc.Find("img")
+		urls    []string
+		srcs    = make([]string, imgs.Length()) // resolved url per img, empty if not to be downloaded
+		urlIdx  = make(map[string]int)
+		origSrc = make(map[string]string)
+	)
+	imgs.Each(func(i int, selection *goquery.Selection) {
+		src, ok := selection.Attr("src")
+		if !ok || strings.HasPrefix(src, "data:") {
+			return
+		}
 
-		src, ok := selection.Attr(attr)
-		if !ok {
+		imgUrl := item.resolveUrl(src)
+		if imgUrl == "" {
+			return
+		}
+		srcs[i] = imgUrl
+		if _, ok := urlIdx[imgUrl]; !ok {
+			urlIdx[imgUrl] = len(urls)
+			urls = append(urls, imgUrl)
+			origSrc[imgUrl] = src
+		}
+	})
+
+	// each image is included only once, even if it is referenced multiple times
+	fetched := item.fetchImages(urls)
+	newSrcs := make([]string, len(urls))
+	for i, img := range fetched {
+		if img.data != nil {
+			newSrcs[i] = item.imageSrc(img, imageName(origSrc[urls[i]]))
+		}
+	}
+
+	imgs.Each(func(i int, selection *goquery.Selection) {
+		if _, ok := selection.Attr("src"); !ok {
 			return
 		}
 
-		if !strings.HasPrefix(src, "data:") {
-			if imgStr := item.downloadImage(src); imgStr != "" {
-				selection.SetAttr(attr, imgStr)
+		if srcs[i] != "" {
+			if newSrc := newSrcs[urlIdx[srcs[i]]]; newSrc != "" {
+				selection.SetAttr("src", newSrc)
 			}
 		}
 
@@ -1,31 +1,122 @@
 package feed
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	nethttp "net/http"
 	"os/exec"
 
 	"github.com/Necoro/gofeed"
 
 	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/pkg/log"
 )
 
+// reset clears the results of a previous fetch.
+func (feed *Feed) reset() {
+	feed.feed = nil
+	feed.items = nil
+	feed.notModified = false
+	feed.fetched = http.Validators{}
+	feed.fetchError = http.Error{}
+	feed.movedTo = ""
+	feed.newlyDiscovered = ""
+}
+
+// get fetches the URL with the given validators. It records the results of the fetch in the feed.
+func (feed *Feed) get(url string, validators http.Validators) ([]byte, *nethttp.Response, error) {
+	// we do not use the http support in gofeed, so that we can control the behavior of http requests
+	// and ensure it to be the same in all places
+	resp, cancel, err := http.GetConditional(url, feed.Context(), validators)
+	if errors.Is(err, http.ErrNotModified) {
+		feed.notModified = true
+		feed.fetched = validators
+		return nil, nil, nil
+	}
+	if err != nil {
+		errors.As(err, &feed.fetchError) // keep status and Retry-After for the backoff
+		return nil, nil, fmt.Errorf("while fetching %s from %s: %w", feed.Name, url, err)
+	}
+	defer cancel() // includes resp.Body.Close
+
+	feed.fetched = http.ValidatorsOf(resp)
+	feed.movedTo = http.PermanentRedirect(resp)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while fetching %s from %s: %w", feed.Name, url, err)
+	}
+	return body, resp, nil
+}
+
+// fetch retrieves the feed via HTTP. If its URL points to an HTML page, the feed linked from there is fetched instead.
+func (feed *Feed) fetch() ([]byte, error) {
+	url := feed.fetchUrl()
+	body, resp, err := feed.get(url, feed.validators)
+	if err != nil || feed.notModified {
+		return nil, err
+	}
+
+	if gofeed.DetectFeedType(bytes.NewReader(body)) != gofeed.FeedTypeUnknown || !http.IsHtml(resp, body) {
+		// either a feed or something unknown that the parser should complain about
+		return body, nil
+	}
+
+	discovered, err := discover(body, resp.Request.URL)
+	if err != nil {
+		return nil, fmt.Errorf("feed %s: %s is an HTML page: %w", feed.Name, url, err)
+	}
+	log.Printf("Feed %s: Found feed '%s' linked from HTML page '%s'.", feed.Name, discovered, url)
+
+	// the validators of the HTML page do not apply to the feed
+	if body, _, err = feed.get(discovered, http.Validators{}); err != nil {
+		return nil, err
+	}
+	feed.newlyDiscovered = discovered
+	return body, nil
+}
+
 func (feed *Feed) Parse() error {
+	feed.reset()
+
+	var custom func() (*gofeed.Feed, error)
+	switch {
+	case feed.Scrape != nil:
+		custom = feed.scrape
+	case feed.Json != nil:
+		custom = feed.fetchJson
+	case feed.IsStdin():
+		custom = feed.parseStdin
+	case feed.IsFile():
+		custom = feed.parseFiles
+	}
+
+	if custom != nil {
+		parsedFeed, err := custom()
+		if err != nil || feed.notModified {
+			return err
+		}
+		feed.setFeed(parsedFeed)
+		return nil
+	}
+
 	fp := gofeed.NewParser()
 
 	var reader io.Reader
 	var cleanup func() error
 
 	if feed.Url != "" {
-		// we do not use the http support in gofeed, so that we can control the behavior of http requests
-		// and ensure it to be the same in all places
-		resp, cancel, err := http.Get(feed.Url, feed.Context())
-		if err != nil {
-			return fmt.Errorf("while fetching %s from %s: %w", feed.Name, feed.Url, err)
+		body, err := feed.fetch()
+		if err != nil || feed.notModified {
+			return err
+		}
+		if body, err = feed.preprocess(body); err != nil {
+			return err
 		}
-		defer cancel() // includes resp.Body.Close
 
-		reader = resp.Body
+		reader = bytes.NewReader(body)
 		cleanup = func() error { return nil }
 	} else { // exec
 		// we use the same context as for HTTP
@@ -48,6 +139,23 @@ func (feed *Feed) Parse() error {
 
 		reader = stdout
 		cleanup = cmd.Wait
+
+		if len(feed.preprocessors) > 0 {
+			// preprocessing needs the complete output
+			body, err := io.ReadAll(stdout)
+			if err != nil {
+				return fmt.Errorf("reading output of exec for feed '%s': %w", feed.Name, err)
+			}
+			if err = cmd.Wait(); err != nil {
+				return fmt.Errorf("running exec for feed '%s': %w", feed.Name, err)
+			}
+			if body, err = feed.preprocess(body); err != nil {
+				return err
+			}
+
+			reader = bytes.NewReader(body)
+			cleanup = func() error { return nil }
+		}
 	}
 
 	parsedFeed, err := fp.Parse(reader)
@@ -55,10 +163,14 @@ func (feed *Feed) Parse() error {
 		return fmt.Errorf("parsing feed '%s': %w", feed.Name, err)
 	}
 
+	feed.setFeed(parsedFeed)
+	return cleanup()
+}
+
+func (feed *Feed) setFeed(parsedFeed *gofeed.Feed) {
 	feed.feed = parsedFeed
 	feed.items = make([]Item, len(parsedFeed.Items))
 	for idx, feedItem := range parsedFeed.Items {
 		feed.items[idx] = Item{Feed: parsedFeed, feed: feed, Item: feedItem, ID: newItemID()}
 	}
-	return cleanup()
 }
@@ -0,0 +1,163 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// preprocessor transforms the raw body of a feed before it is parsed.
+type preprocessor func(ctx context.Context, body []byte) ([]byte, error)
+
+// newPreprocessors builds the preprocessing pipeline: First the built-in steps in the given order, then the command.
+func newPreprocessors(steps []string, command []string) ([]preprocessor, error) {
+	var res []preprocessor
+	for _, step := range steps {
+		name, arg, _ := strings.Cut(strings.TrimSpace(step), "=")
+		switch name {
+		case "charset":
+			enc, _ := charset.Lookup(arg)
+			if enc == nil {
+				return nil, fmt.Errorf("preprocess: unknown charset '%s'", arg)
+			}
+			res = append(res, convertCharset(enc))
+		case "strip-invalid-chars":
+			res = append(res, stripInvalidChars)
+		case "fix-entities":
+			res = append(res, fixEntities)
+		default:
+			return nil, fmt.Errorf("preprocess: unknown step '%s'", step)
+		}
+	}
+	if len(command) > 0 {
+		res = append(res, runCommand(command))
+	}
+	return res, nil
+}
+
+// preprocess runs the body through the preprocessing pipeline of the feed.
+func (feed *Feed) preprocess(body []byte) ([]byte, error) {
+	if len(feed.preprocessors) == 0 {
+		return body, nil
+	}
+
+	ctx, cancel := feed.Context().StdContext()
+	defer cancel()
+
+	var err error
+	for _, p := range feed.preprocessors {
+		if body, err = p(ctx, body); err != nil {
+			return nil, fmt.Errorf("preprocessing feed '%s': %w", feed.Name, err)
+		}
+	}
+	return body, nil
+}
+
+var xmlEncoding = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding\s*=\s*)["'][^"']*["']`)
+
+// convertCharset decodes the body from the given charset, regardless of what the feed claims, and converts it to UTF-8.
+func convertCharset(enc encoding.Encoding) preprocessor {
+	return func(_ context.Context, body []byte) ([]byte, error) {
+		body, err := enc.NewDecoder().Bytes(body)
+		if err != nil {
+			return nil, err
+		}
+		// the declaration must not claim the old charset anymore
+		return xmlEncoding.ReplaceAll(body, []byte(`${1}"UTF-8"`)), nil
+	}
+}
+
+// isXmlChar returns whether r may occur in an XML 1.0 document.
+func isXmlChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// stripInvalidChars removes invalid UTF-8 sequences and characters not allowed in XML, like most control characters.
+func stripInvalidChars(_ context.Context, body []byte) ([]byte, error) {
+	res := make([]byte, 0, len(body))
+	for len(body) > 0 {
+		r, size := utf8.DecodeRune(body)
+		if (r != utf8.RuneError || size > 1) && isXmlChar(r) {
+			res = append(res, body[:size]...)
+		}
+		body = body[size:]
+	}
+	return res, nil
+}
+
+var (
+	entity = regexp.MustCompile(`&(#[0-9]+;|#[xX][0-9a-fA-F]+;|[a-zA-Z][a-zA-Z0-9]*;)?`)
+	cdata  = regexp.MustCompile(`(?s)<!\[CDATA\[.*?]]>`)
+)
+
+// fixEntity replaces an HTML entity, which is unknown to XML, by numeric character references.
+// An ampersand not starting a valid entity is escaped.
+func fixEntity(ent []byte) []byte {
+	switch str := string(ent); str {
+	case "&", "&amp;", "&lt;", "&gt;", "&quot;", "&apos;":
+		if str == "&" {
+			return []byte("&amp;")
+		}
+		return ent
+	default:
+		if str[1] == '#' {
+			return ent
+		}
+		unescaped := html.UnescapeString(str)
+		if unescaped == str { // unknown
+			return append([]byte("&amp;"), ent[1:]...)
+		}
+
+		var res []byte
+		for _, r := range unescaped {
+			res = fmt.Appendf(res, "&#%d;", r)
+		}
+		return res
+	}
+}
+
+// fixEntities makes HTML entities and stray ampersands valid XML. CDATA sections are kept as they are.
+func fixEntities(_ context.Context, body []byte) ([]byte, error) {
+	var res bytes.Buffer
+	res.Grow(len(body))
+
+	last := 0
+	for _, loc := range cdata.FindAllIndex(body, -1) {
+		res.Write(entity.ReplaceAllFunc(body[last:loc[0]], fixEntity))
+		res.Write(body[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	res.Write(entity.ReplaceAllFunc(body[last:], fixEntity))
+
+	return res.Bytes(), nil
+}
+
+// runCommand pipes the body through an external command.
+func runCommand(command []string) preprocessor {
+	return func(ctx context.Context, body []byte) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("running '%s': %w (%s)", command[0], err, msg)
+			}
+			return nil, fmt.Errorf("running '%s': %w", command[0], err)
+		}
+		return stdout.Bytes(), nil
+	}
+}
@@ -0,0 +1,70 @@
+package feed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreprocess(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []string
+		command []string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "None", input: "<rss/>", want: "<rss/>"},
+		{name: "Charset", steps: []string{"charset=windows-1252"},
+			input: "<?xml version=\"1.0\" encoding='UTF-8'?><title>Caf\xe9 \x80</title>",
+			want:  `<?xml version="1.0" encoding="UTF-8"?><title>Café €</title>`},
+		{name: "Charset without declaration", steps: []string{"charset=latin1"},
+			input: "<title>Caf\xe9</title>", want: "<title>Café</title>"},
+		{name: "Strip", steps: []string{"strip-invalid-chars"},
+			input: "<title>A\x00B\x1bC\tD\xffE ü</title>", want: "<title>ABC\tDE ü</title>"},
+		{name: "Entities", steps: []string{"fix-entities"},
+			input: "<title>Tom &amp; Jerry &nbsp;&eacute;&#233;&#xE9; & &foo; &lt;b&gt;</title>",
+			want:  "<title>Tom &amp; Jerry &#160;&#233;&#233;&#xE9; &amp; &amp;foo; &lt;b&gt;</title>"},
+		{name: "Entities in CDATA", steps: []string{"fix-entities"},
+			input: "<a>&nbsp;</a><b><![CDATA[&nbsp; & ]]></b><c>&</c>",
+			want:  "<a>&#160;</a><b><![CDATA[&nbsp; & ]]></b><c>&amp;</c>"},
+		{name: "Pipeline", steps: []string{"strip-invalid-chars", "fix-entities"},
+			input: "<title>\x01&hellip;</title>", want: "<title>&#8230;</title>"},
+		{name: "Command", steps: []string{"fix-entities"}, command: []string{"tr", "a-z", "A-Z"},
+			input: "<title>&auml;</title>", want: "<TITLE>&#228;</TITLE>"},
+		{name: "Failing command", command: []string{"false"}, input: "<rss/>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preprocessors, err := newPreprocessors(tt.steps, tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []byte(tt.input)
+			for _, p := range preprocessors {
+				if got, err = p(context.Background(), got); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("preprocess error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); !tt.wantErr && diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestNewPreprocessorsInvalid(t *testing.T) {
+	for _, steps := range [][]string{{"charset=no-such-charset"}, {"unknown"}} {
+		if _, err := newPreprocessors(steps, nil); err == nil {
+			t.Errorf("newPreprocessors(%v) should fail", steps)
+		}
+	}
+}
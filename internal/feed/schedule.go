@@ -0,0 +1,207 @@
+package feed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const minutesPerDay = 24 * 60
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a recurring period of time in which a feed may be fetched, e.g. "Mon-Fri 06:00-22:00".
+type window struct {
+	days       [7]bool
+	start, end int // minutes since midnight; if end < start, the window spans midnight
+}
+
+// parseWindow parses a window of the form "[DAYS] [HH:MM-HH:MM]", where DAYS is a comma separated list
+// of days or ranges of days (e.g. "Mon-Fri,Sun"). Hours may be given without minutes ("6-22").
+// Omitting the days means every day, omitting the times means the whole day.
+func parseWindow(str string) (window, error) {
+	var w window
+
+	fields := strings.Fields(str)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("invalid fetch window %q", str)
+	}
+
+	timeStr := fields[len(fields)-1]
+	if len(fields) == 2 || !strings.ContainsAny(timeStr, "0123456789") {
+		if err := w.parseDays(fields[0]); err != nil {
+			return w, fmt.Errorf("invalid fetch window %q: %w", str, err)
+		}
+		if len(fields) == 1 {
+			w.start, w.end = 0, minutesPerDay
+			return w, nil
+		}
+	} else {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	from, to, ok := strings.Cut(timeStr, "-")
+	if !ok {
+		return w, fmt.Errorf("invalid fetch window %q: time range must be of the form 'HH:MM-HH:MM'", str)
+	}
+
+	var err error
+	if w.start, err = parseTimeOfDay(from); err == nil {
+		w.end, err = parseTimeOfDay(to)
+	}
+	if err != nil {
+		return w, fmt.Errorf("invalid fetch window %q: %w", str, err)
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("invalid fetch window %q: time range is empty", str)
+	}
+
+	return w, nil
+}
+
+func (w *window) parseDays(str string) error {
+	for part := range strings.SplitSeq(strings.ToLower(str), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		fromDay, ok := weekdays[from]
+		if !ok {
+			return fmt.Errorf("unknown day %q", from)
+		}
+		toDay, ok := weekdays[to]
+		if !ok {
+			return fmt.Errorf("unknown day %q", to)
+		}
+
+		for d := fromDay; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == toDay {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseTimeOfDay(str string) (int, error) {
+	hStr, mStr, hasMinutes := strings.Cut(str, ":")
+
+	h, err := strconv.Atoi(hStr)
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid time %q", str)
+	}
+
+	m := 0
+	if hasMinutes {
+		if m, err = strconv.Atoi(mStr); err != nil || m < 0 || m > 59 || (h == 24 && m > 0) {
+			return 0, fmt.Errorf("invalid time %q", str)
+		}
+	}
+
+	return h*60 + m, nil
+}
+
+func minuteOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+func (w window) contains(t time.Time) bool {
+	m := minuteOfDay(t)
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && w.start <= m && m < w.end
+	}
+
+	// spanning midnight: either after the start on this day, or before the end on the day after
+	yesterday := (day + 6) % 7
+	return (w.days[day] && m >= w.start) || (w.days[yesterday] && m < w.end)
+}
+
+// next returns the earliest time not before t, that lies inside the window.
+func (w window) next(t time.Time) time.Time {
+	if w.contains(t) {
+		return t
+	}
+
+	y, mon, d := t.Date()
+	for i := range 8 {
+		start := time.Date(y, mon, d+i, w.start/60, w.start%60, 0, 0, t.Location())
+		if w.days[start.Weekday()] && !start.Before(t) {
+			return start
+		}
+	}
+
+	panic("fetch window without days")
+}
+
+// schedule determines when a feed is to be fetched.
+type schedule struct {
+	cron    cron.Schedule // nil if not set
+	windows []window
+}
+
+func newSchedule(cronSpec string, windowSpecs []string) (schedule, error) {
+	var (
+		s   schedule
+		err error
+	)
+
+	if cronSpec != "" {
+		if s.cron, err = cron.ParseStandard(cronSpec); err != nil {
+			return s, fmt.Errorf("invalid schedule %q: %w", cronSpec, err)
+		}
+	}
+
+	for _, spec := range windowSpecs {
+		w, err := parseWindow(spec)
+		if err != nil {
+			return s, err
+		}
+		s.windows = append(s.windows, w)
+	}
+
+	return s, nil
+}
+
+// allowed returns whether t lies inside one of the fetch windows. If there are none, everything is allowed.
+func (s schedule) allowed(t time.Time) bool {
+	if len(s.windows) == 0 {
+		return true
+	}
+
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextAllowed returns the earliest time not before t, that lies inside one of the fetch windows.
+func (s schedule) nextAllowed(t time.Time) time.Time {
+	if s.allowed(t) {
+		return t
+	}
+
+	var next time.Time
+	for _, w := range s.windows {
+		if n := w.next(t); next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+	return next
+}
@@ -0,0 +1,90 @@
+package feed
+
+import (
+	"testing"
+	"time"
+)
+
+// 2024-01-01 is a Monday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"Mon-Fri 06:00-22:00", false},
+		{"Mon-Fri 6-22", false},
+		{"Sat,Sun", false},
+		{"Fri-Mon 22:30-02:00", false},
+		{"08:00-12:00", false},
+		{"", true},
+		{"Mon-Fri 06:00-22:00 foo", true},
+		{"Someday 06:00-22:00", true},
+		{"Mon 06:00", true},
+		{"Mon 06:61-07:00", true},
+		{"Mon 25-26", true},
+		{"08:00-08:00", true},
+		{"Mon 0-24", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := parseWindow(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWindow(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWindowNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		t    time.Time
+		next time.Time
+	}{
+		{"Mon-Fri 6-22", at(1, 12, 0), at(1, 12, 0)},
+		{"Mon-Fri 6-22", at(1, 5, 59), at(1, 6, 0)},
+		{"Mon-Fri 6-22", at(1, 22, 0), at(2, 6, 0)},
+		{"Mon-Fri 6-22", at(5, 23, 0), at(8, 6, 0)},
+		{"Mon-Fri 6-22", at(6, 12, 0), at(8, 6, 0)},
+		{"Sat,Sun", at(3, 12, 0), at(6, 0, 0)},
+		{"Sat,Sun", at(7, 23, 59), at(7, 23, 59)},
+		{"Mon 22:00-02:00", at(2, 1, 0), at(2, 1, 0)},
+		{"Mon 22:00-02:00", at(2, 2, 0), at(8, 22, 0)},
+		{"Mon 22:00-02:00", at(1, 21, 0), at(1, 22, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" "+tt.t.Format(time.DateTime), func(t *testing.T) {
+			w, err := parseWindow(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := w.next(tt.t); !next.Equal(tt.next) {
+				t.Errorf("Expected %s, got %s", tt.next.Format(time.DateTime), next.Format(time.DateTime))
+			}
+		})
+	}
+}
+
+func TestScheduleNextAllowed(t *testing.T) {
+	s, err := newSchedule("", []string{"Mon-Fri 6-22", "Sat 10:00-12:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := s.nextAllowed(at(5, 23, 0)); !next.Equal(at(6, 10, 0)) {
+		t.Errorf("Expected Saturday 10:00, got %s", next.Format(time.DateTime))
+	}
+	if next := s.nextAllowed(at(6, 13, 0)); !next.Equal(at(8, 6, 0)) {
+		t.Errorf("Expected Monday 06:00, got %s", next.Format(time.DateTime))
+	}
+
+	if _, err := newSchedule("every now and then", nil); err == nil {
+		t.Error("Expected error for invalid cron expression")
+	}
+}
@@ -0,0 +1,166 @@
+package feed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Necoro/gofeed"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/itlightning/dateparse"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// selector is a CSS selector, optionally followed by '@attr' to select the value of an attribute.
+type selector struct {
+	css  string
+	attr string
+}
+
+func parseSelector(str string) selector {
+	css, attr, _ := strings.Cut(strings.TrimSpace(str), "@")
+	return selector{strings.TrimSpace(css), strings.TrimSpace(attr)}
+}
+
+// find returns the elements selected inside of s. An empty CSS selector denotes s itself.
+func (sel selector) find(s *goquery.Selection) *goquery.Selection {
+	if sel.css == "" {
+		return s
+	}
+	return s.Find(sel.css).First()
+}
+
+// text returns the attribute or the text of the selected element.
+func (sel selector) text(s *goquery.Selection) string {
+	found := sel.find(s)
+	if sel.attr != "" {
+		return strings.TrimSpace(found.AttrOr(sel.attr, ""))
+	}
+	return strings.Join(strings.Fields(found.Text()), " ")
+}
+
+// scrape fetches the page of the feed and builds the feed from the elements selected there.
+func (feed *Feed) scrape() (*gofeed.Feed, error) {
+	sc := feed.Scrape
+
+	pageUrl := feed.fetchUrl()
+	body, resp, err := feed.get(pageUrl, feed.validators)
+	if err != nil || feed.notModified {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing page of feed '%s': %w", feed.Name, err)
+	}
+
+	parsedFeed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     resp.Request.URL.String(),
+		FeedLink: resp.Request.URL.String(),
+		FeedType: "scrape",
+	}
+	if parsedFeed.Title == "" {
+		parsedFeed.Title = feed.Name
+	}
+
+	doc.Find(sc.Item).Each(func(i int, s *goquery.Selection) {
+		if item := scrapeItem(sc, s, resp.Request.URL); item != nil {
+			parsedFeed.Items = append(parsedFeed.Items, item)
+		} else {
+			log.Debugf("Feed %s: Ignoring element %d of the page, as it neither has a title nor a link.", feed.Name, i)
+		}
+	})
+
+	if len(parsedFeed.Items) == 0 {
+		log.Warnf("Feed %s: Selector '%s' does not match anything on '%s'.", feed.Name, sc.Item, pageUrl)
+	}
+
+	return parsedFeed, nil
+}
+
+// scrapeItem builds an item out of the selected element s. Returns nil, if there is neither a title nor a link.
+func scrapeItem(sc *config.Scrape, s *goquery.Selection, base *url.URL) *gofeed.Item {
+	item := &gofeed.Item{}
+
+	link := parseSelector(sc.Link)
+	if link.css == "" && link.attr == "" {
+		if goquery.NodeName(s) == "a" {
+			link = selector{attr: "href"}
+		} else {
+			link = selector{css: "a[href]", attr: "href"}
+		}
+	} else if link.attr == "" {
+		link.attr = "href"
+	}
+	if href := link.text(s); href != "" {
+		if u, err := base.Parse(href); err == nil {
+			item.Link = u.String()
+			item.Links = []string{item.Link}
+		}
+	}
+
+	if sc.Title != "" {
+		item.Title = parseSelector(sc.Title).text(s)
+	} else {
+		item.Title = strings.Join(strings.Fields(link.find(s).Text()), " ")
+	}
+
+	if item.Title == "" && item.Link == "" {
+		return nil
+	}
+
+	date := parseSelector(sc.Date)
+	if date.css == "" && date.attr == "" {
+		date = selector{css: "time"}
+	}
+	if t := scrapeDate(date, s); !t.IsZero() {
+		item.Published = t.Format(time.RFC3339)
+		item.PublishedParsed = &t
+	}
+
+	content := parseSelector(sc.Content)
+	if content.attr != "" {
+		item.Content = content.text(s)
+	} else if html, err := content.find(s).Html(); err == nil {
+		item.Content = strings.TrimSpace(html)
+	}
+
+	// the link is the natural identity of a scraped item; otherwise we have to resort to the title
+	if item.Link != "" {
+		item.GUID = item.Link
+	} else {
+		sum := sha256.Sum256([]byte(item.Title))
+		item.GUID = "scrape:" + hex.EncodeToString(sum[:])
+	}
+
+	return item
+}
+
+// scrapeDate returns the date of the selected element. For elements without an explicitly given attribute,
+// the 'datetime' attribute (as used by <time>) is preferred over the text.
+func scrapeDate(sel selector, s *goquery.Selection) time.Time {
+	var str string
+	if sel.attr == "" {
+		str = strings.TrimSpace(sel.find(s).AttrOr("datetime", ""))
+	}
+	if str == "" {
+		str = sel.text(s)
+	}
+	if str == "" {
+		return time.Time{}
+	}
+
+	t, err := dateparse.ParseLocal(str)
+	if err != nil {
+		log.Debugf("Cannot parse date '%s': %s", str, err)
+		return time.Time{}
+	}
+	return t
+}
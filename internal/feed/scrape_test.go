@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+const scrapePage = `<!DOCTYPE html>
+<html>
+<head><title>News of Example</title></head>
+<body>
+  <article class="post">
+    <h2><a href="/news/1">First   News</a></h2>
+    <time datetime="2024-01-02T10:00:00Z">2 January</time>
+    <div class="summary"><p>Something happened.</p></div>
+  </article>
+  <article class="post">
+    <h2><a href="https://example.net/news/2">Second News</a></h2>
+    <span class="date">2024-01-03</span>
+    <div class="summary"><p>More happened.</p></div>
+  </article>
+  <article class="post">
+    <p>Neither title nor link</p>
+  </article>
+</body>
+</html>`
+
+type scrapedItem struct {
+	Title, Link, GUID, Content string
+	Date                       time.Time
+}
+
+func TestScrape(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(scrapePage))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		scrape config.Scrape
+		want   []scrapedItem
+	}{
+		{"Defaults", config.Scrape{Item: "article.post"}, []scrapedItem{
+			{Title: "First News", Link: srv.URL + "/news/1", GUID: srv.URL + "/news/1",
+				Date: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)},
+			{Title: "Second News", Link: "https://example.net/news/2", GUID: "https://example.net/news/2"},
+		}},
+		{"Selectors", config.Scrape{Item: "article.post", Title: "h2", Link: "h2 a@href", Date: ".date", Content: ".summary"}, []scrapedItem{
+			{Title: "First News", Link: srv.URL + "/news/1", GUID: srv.URL + "/news/1",
+				Content: "<p>Something happened.</p>"},
+			{Title: "Second News", Link: "https://example.net/news/2", GUID: "https://example.net/news/2",
+				Content: "<p>More happened.</p>", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local)},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := tt.scrape
+			sc.Url = srv.URL + "/news"
+			f, err := Create(&config.Feed{Name: "Example", Scrape: &sc}, config.GlobalOptions{Timeout: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = f.Parse(); err != nil {
+				t.Fatal(err)
+			}
+			if f.feed.Title != "News of Example" {
+				t.Errorf("Unexpected feed title %q", f.feed.Title)
+			}
+
+			var got []scrapedItem
+			for _, item := range f.items {
+				si := scrapedItem{Title: item.Title, Link: item.Link, GUID: item.GUID}
+				if tt.scrape.Content != "" {
+					si.Content = item.Content
+				}
+				if item.PublishedParsed != nil {
+					si.Date = *item.PublishedParsed
+				}
+				got = append(got, si)
+			}
+
+			if diff := cmp.Diff(tt.want, got, cmp.Comparer(time.Time.Equal)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"sync/atomic"
 	text "text/template"
 
 	"github.com/Necoro/feed2imap-go/pkg/log"
@@ -19,9 +20,10 @@ type template interface {
 }
 
 type Template struct {
-	template
+	name    string
 	useHtml bool
 	dflt    string
+	current *atomic.Value // the template in use; swapped on loading
 }
 
 //go:embed html.tpl
@@ -31,37 +33,74 @@ var defaultHtmlTpl string
 var defaultTextTpl string
 
 var Html = Template{
-	useHtml:  true,
-	dflt:     defaultHtmlTpl,
-	template: html.New("Html").Funcs(funcMap),
+	name:    "Html",
+	useHtml: true,
+	dflt:    defaultHtmlTpl,
+	current: new(atomic.Value),
 }
 
 var Text = Template{
-	useHtml:  false,
-	dflt:     defaultTextTpl,
-	template: text.New("Text").Funcs(funcMap),
+	name:    "Text",
+	useHtml: false,
+	dflt:    defaultTextTpl,
+	current: new(atomic.Value),
+}
+
+func (tpl Template) Name() string {
+	return tpl.name
+}
+
+func (tpl Template) Execute(wr io.Writer, data any) error {
+	return tpl.current.Load().(template).Execute(wr, data)
 }
 
 func (tpl *Template) loadDefault() {
-	if err := tpl.load(tpl.dflt); err != nil {
+	if err := tpl.load(""); err != nil {
 		panic(err)
 	}
 }
 
-func (tpl *Template) load(content string) (err error) {
+// load parses the given content on top of the default template and, if successful, replaces the current template.
+// Hence, custom templates may use everything defined in the default one.
+func (tpl *Template) load(content string) error {
+	var t template
 	if tpl.useHtml {
-		_, err = tpl.template.(*html.Template).Parse(content)
+		htmlTpl, err := html.New(tpl.name).Funcs(funcMap).Parse(tpl.dflt)
+		if err == nil && content != "" {
+			htmlTpl, err = htmlTpl.Parse(content)
+		}
+		if err != nil {
+			return err
+		}
+		t = htmlTpl
 	} else {
-		_, err = tpl.template.(*text.Template).Parse(content)
+		textTpl, err := text.New(tpl.name).Funcs(funcMap).Parse(tpl.dflt)
+		if err == nil && content != "" {
+			textTpl, err = textTpl.Parse(content)
+		}
+		if err != nil {
+			return err
+		}
+		t = textTpl
 	}
-	return
+
+	tpl.current.Store(t)
+	return nil
 }
 
+// LoadFile replaces the template by the one in the given file.
+// An empty file name restores the default template.
 func (tpl *Template) LoadFile(file string) error {
+	if file == "" {
+		tpl.loadDefault()
+		return nil
+	}
+
 	content, err := os.ReadFile(file)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			log.Errorf("Template file '%s' does not exist, keeping default.", file)
+			tpl.loadDefault()
 			return nil
 		} else {
 			return fmt.Errorf("reading template file '%s': %w", file, err)
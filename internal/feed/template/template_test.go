@@ -1,7 +1,58 @@
 package template
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestTemplateDefaults(t *testing.T) {
 	// Dummy test to ensure init() works, i.e. the default templates are loaded
 }
+
+func TestLoadFile(t *testing.T) {
+	defer Text.loadDefault()
+
+	file := filepath.Join(t.TempDir(), "text.tpl")
+	if err := os.WriteFile(file, []byte(`Custom {{.}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func() string {
+		var b strings.Builder
+		if err := Text.Execute(&b, "foo"); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	if err := Text.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("Custom foo", execute()); diff != "" {
+		t.Error(diff)
+	}
+
+	// invalid templates keep the current one
+	if err := os.WriteFile(file, []byte(`Broken {{.`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Text.LoadFile(file); err == nil {
+		t.Error("Expected error for invalid template")
+	}
+	if diff := cmp.Diff("Custom foo", execute()); diff != "" {
+		t.Error(diff)
+	}
+
+	// empty file name restores the default
+	if err := Text.LoadFile(""); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	if err := Text.Execute(&b, "foo"); err == nil && b.String() == "Custom foo" {
+		t.Error("Default template has not been restored")
+	}
+}
@@ -2,92 +2,334 @@ package http
 
 import (
 	ctxt "context"
-	"crypto/tls"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
 )
 
-// share HTTP clients
+// share HTTP clients: one per combination of proxy and TLS settings
 var (
-	stdClient    *http.Client
-	unsafeClient *http.Client
+	clients   = map[clientKey]*http.Client{}
+	clientsMu sync.Mutex
 )
 
+type clientKey struct {
+	proxy      string
+	disableTLS bool
+	tls        string // the custom TLS settings, joined
+}
+
 // Error represents an HTTP error returned by a server.
 type Error struct {
 	StatusCode int
 	Status     string
+	RetryAfter time.Time // as requested by the server; zero if not given
+}
+
+// ErrNotModified is returned when a conditional request is answered with '304 Not Modified'.
+var ErrNotModified = errors.New("not modified")
+
+// Validators of a previous response, used for conditional requests.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+func (v Validators) Empty() bool {
+	return v.ETag == "" && v.LastModified == ""
 }
 
 type Context struct {
-	Timeout    int
-	DisableTLS bool
+	Timeout     int
+	DisableTLS  bool
+	Proxy       string // proxy URL, DirectProxy, or empty to use the environment
+	TLS         config.TLS
+	Credentials *Credentials // nil if there are none
+	Jar         *CookieJar   // nil if cookies are not kept
 }
 
 func (err Error) Error() string {
 	return fmt.Sprintf("http error: %s", err.Status)
 }
 
-func init() {
-	// std
-	stdClient = &http.Client{Transport: http.DefaultTransport}
+// DirectProxy as proxy disables the use of any proxy, including the one set in the environment.
+const DirectProxy = "direct"
+
+// proxyFunc returns the proxy function for a transport.
+func proxyFunc(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case DirectProxy:
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy '%s': %w", proxy, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy '%s': unsupported scheme '%s'", proxy, u.Scheme)
+	}
+	return http.ProxyURL(u), nil
+}
+
+// ValidateProxy checks whether proxy is valid as Context.Proxy.
+func ValidateProxy(proxy string) error {
+	_, err := proxyFunc(proxy)
+	return err
+}
+
+func newClient(ctx Context) (*http.Client, error) {
+	proxy, err := proxyFunc(ctx.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := ctx.TLS.Build(ctx.DisableTLS)
+	if err != nil {
+		return nil, err
+	}
 
-	// unsafe
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
 	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = tlsConfig
-	unsafeClient = &http.Client{Transport: transport}
+	transport.Proxy = proxy
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport, CheckRedirect: checkRedirect}, nil
+}
+
+// redirectTracker follows the redirects of a request, to find out whether it has moved permanently.
+type redirectTracker struct {
+	permanent string // target of the chain of permanent redirects
+	temporary bool   // the chain has been interrupted by a temporary redirect
+}
+
+type redirectKey struct{}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	// same as the default policy
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	if creds, ok := req.Context().Value(credentialsKey{}).(*Credentials); ok {
+		creds.strip(req)
+	}
+
+	if tracker, ok := req.Context().Value(redirectKey{}).(*redirectTracker); ok && !tracker.temporary {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			tracker.permanent = req.URL.String()
+		default:
+			tracker.temporary = true
+		}
+	}
+	return nil
+}
+
+// PermanentRedirect returns the URL the request of the response has been permanently redirected to.
+// Redirects after a temporary one are not considered. Returns the empty string if there is no such redirect.
+func PermanentRedirect(resp *http.Response) string {
+	if tracker, ok := resp.Request.Context().Value(redirectKey{}).(*redirectTracker); ok {
+		return tracker.permanent
+	}
+	return ""
 }
 
 func (ctx Context) StdContext() (ctxt.Context, ctxt.CancelFunc) {
 	return ctxt.WithTimeout(ctxt.Background(), time.Duration(ctx.Timeout)*time.Second)
 }
 
-func client(disableTLS bool) *http.Client {
-	if disableTLS {
-		return unsafeClient
+func clientKeyOf(ctx Context) clientKey {
+	return clientKey{
+		proxy:      ctx.Proxy,
+		disableTLS: ctx.DisableTLS,
+		tls:        strings.Join(append([]string{ctx.TLS.CA, ctx.TLS.Cert, ctx.TLS.Key}, ctx.TLS.Pins...), "\x00"),
 	}
-	return stdClient
+}
+
+// CacheKey returns the key under which the response for the URL may be cached and shared with other contexts.
+// It only equals the URL, if the context has no say in the request: Otherwise, it depends on the credentials
+// (if they are sent to the URL), the proxy and the TLS settings.
+// If cookies would be sent, the response must not be shared at all and false is returned.
+func (ctx Context) CacheKey(rawUrl string) (string, bool) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		// the request will fail anyway
+		return rawUrl, true
+	}
+
+	if ctx.Jar != nil && len(ctx.Jar.Cookies(u)) > 0 {
+		return "", false
+	}
+
+	key := clientKeyOf(ctx)
+	creds := ctx.Credentials
+	if creds != nil && !creds.matches(u) {
+		creds = nil
+	}
+	if key == (clientKey{}) && creds == nil {
+		return rawUrl, true
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%q %t %q", key.proxy, key.disableTLS, key.tls)
+	if creds != nil {
+		// the header is printed with sorted keys
+		_, _ = fmt.Fprintf(h, " %v %q %q %q", creds.Header, creds.User, creds.Password, creds.Token)
+	}
+	return rawUrl + "\x00" + hex.EncodeToString(h.Sum(nil)), true
+}
+
+func client(ctx Context) (*http.Client, error) {
+	key := clientKeyOf(ctx)
+
+	clientsMu.Lock()
+	c, ok := clients[key]
+	if !ok {
+		var err error
+		if c, err = newClient(ctx); err != nil {
+			clientsMu.Unlock()
+			return nil, err
+		}
+		clients[key] = c
+	}
+	clientsMu.Unlock()
+
+	if ctx.Jar != nil {
+		// the transport is shared nevertheless
+		withJar := *c
+		withJar.Jar = ctx.Jar
+		c = &withJar
+	}
+	return c, nil
 }
 
 var noop ctxt.CancelFunc = func() {}
 
+// ValidatorsOf returns the validators of the response, to be used for the next conditional request.
+func ValidatorsOf(resp *http.Response) Validators {
+	return Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// retryAfter interprets the value of a 'Retry-After' header, which is either a number of seconds or a date.
+func retryAfter(value string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(secs) * time.Second)
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// IsHtml returns whether the response is an HTML page, judging by its content type or by sniffing its body.
+func IsHtml(resp *http.Response, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+			return true
+		}
+	}
+	return strings.HasPrefix(http.DetectContentType(body), "text/html")
+}
+
 func Get(url string, ctx Context) (resp *http.Response, cancel ctxt.CancelFunc, err error) {
+	return GetConditional(url, ctx, Validators{})
+}
+
+// GetConditional is like Get, but sends the given validators along.
+// If the server answers with '304 Not Modified', ErrNotModified is returned.
+func GetConditional(url string, ctx Context, validators Validators) (resp *http.Response, cancel ctxt.CancelFunc, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, noop, err
+	}
+
+	// waiting for a free slot does not count towards the timeout
+	release := limits.acquire(req.URL.Host)
+
 	prematureExit := true
 	stdCtx, ctxCancel := ctx.StdContext()
 
-	cancel = func() {
-		if resp != nil {
-			_ = resp.Body.Close()
+	// NB: not using the named results here, as early returns reset them
+	var response *http.Response
+	cleanup := func() {
+		if response != nil {
+			_ = response.Body.Close()
 		}
 		ctxCancel()
+		release()
 	}
 
 	defer func() {
 		if prematureExit {
-			cancel()
+			cleanup()
 		}
 	}()
 
-	req, err := http.NewRequestWithContext(stdCtx, "GET", url, nil)
+	stdCtx = ctxt.WithValue(stdCtx, redirectKey{}, &redirectTracker{})
+	if ctx.Credentials != nil {
+		stdCtx = ctxt.WithValue(stdCtx, credentialsKey{}, ctx.Credentials)
+	}
+
+	req = req.WithContext(stdCtx)
+	req.Header.Set("User-Agent", "Feed2Imap-Go/1.0")
+	if ctx.Credentials != nil {
+		ctx.Credentials.apply(req)
+	}
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	c, err := client(ctx)
 	if err != nil {
 		return nil, noop, err
 	}
-	req.Header.Set("User-Agent", "Feed2Imap-Go/1.0")
 
-	resp, err = client(ctx.DisableTLS).Do(req)
+	response, err = c.Do(req)
 	if err != nil {
 		return nil, noop, err
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+	if response.StatusCode == http.StatusNotModified && !validators.Empty() {
+		return nil, noop, ErrNotModified
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
 		return nil, noop, Error{
-			StatusCode: resp.StatusCode,
-			Status:     resp.Status,
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			RetryAfter: retryAfter(response.Header.Get("Retry-After"), time.Now()),
 		}
 	}
 
 	prematureExit = false
-	return resp, cancel, nil
+	return response, cleanup, nil
 }
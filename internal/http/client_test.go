@@ -0,0 +1,130 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{"Empty", "", time.Time{}},
+		{"Seconds", "120", now.Add(2 * time.Minute)},
+		{"Seconds with Space", " 30 ", now.Add(30 * time.Second)},
+		{"Negative", "-5", time.Time{}},
+		{"Date", "Mon, 01 Jan 2024 13:00:00 GMT", now.Add(time.Hour)},
+		{"Invalid", "soon", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.value, now); !got.Equal(tt.want) {
+				t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermanentRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/perm", http.RedirectHandler("/perm2", http.StatusMovedPermanently))
+	mux.Handle("/perm2", http.RedirectHandler("/feed", http.StatusPermanentRedirect))
+	mux.Handle("/temp", http.RedirectHandler("/perm2", http.StatusFound))
+	mux.Handle("/mixed", http.RedirectHandler("/temp", http.StatusMovedPermanently))
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("feed"))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/feed", ""},
+		{"/perm", "/feed"},
+		{"/temp", ""},
+		{"/mixed", "/temp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, cancel, err := Get(srv.URL+tt.path, Context{Timeout: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
+
+			want := tt.want
+			if want != "" {
+				want = srv.URL + want
+			}
+			if got := PermanentRedirect(resp); got != want {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	const (
+		img       = "http://img.example.net/logo.gif"
+		cookieImg = "http://cookies.example.net/logo.gif"
+	)
+
+	jar := NewCookieJar()
+	jar.SetCookies(&url.URL{Scheme: "http", Host: "cookies.example.net"}, []*http.Cookie{{Name: "session", Value: "1"}})
+
+	creds := func(host, token string) *Credentials {
+		return &Credentials{Host: host, Token: token}
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		ctx    Context
+		other  Context
+		same   bool
+		shared bool
+	}{
+		{"Plain", img, Context{Timeout: 5}, Context{Timeout: 30}, true, true},
+		{"Proxy", img, Context{Proxy: "http://proxy:3128"}, Context{}, false, true},
+		{"Proxy Differs", img, Context{Proxy: "http://proxy:3128"}, Context{Proxy: "http://other:3128"}, false, true},
+		{"No TLS", img, Context{DisableTLS: true}, Context{}, false, true},
+		{"TLS", img, Context{TLS: config.TLS{Pins: []string{"abc"}}}, Context{}, false, true},
+		{"Credentials", img, Context{Credentials: creds("img.example.net", "a")}, Context{}, false, true},
+		{"Credentials Differ", img, Context{Credentials: creds("img.example.net", "a")}, Context{Credentials: creds("img.example.net", "b")}, false, true},
+		{"Same Credentials", img, Context{Credentials: creds("img.example.net", "a")}, Context{Credentials: creds("img.example.net", "a")}, true, true},
+		{"Credentials of other Host", img, Context{Credentials: creds("feed.example.net", "a")}, Context{}, true, true},
+		{"Cookies of other Host", img, Context{Jar: jar}, Context{}, true, true},
+		{"Cookies", cookieImg, Context{Jar: jar}, Context{}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, shared := tt.ctx.CacheKey(tt.url)
+			other, _ := tt.other.CacheKey(tt.url)
+			if shared != tt.shared {
+				t.Fatalf("Expected shared = %t, got %t", tt.shared, shared)
+			}
+			if shared && (key == other) != tt.same {
+				t.Errorf("Expected same = %t, got keys %q and %q", tt.same, key, other)
+			}
+			if shared && !strings.HasPrefix(key, tt.url) {
+				t.Errorf("Key %q does not start with the URL", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// SavedCookie is a cookie together with the URL it has been received from.
+type SavedCookie struct {
+	Url string
+	http.Cookie
+}
+
+type cookieKey struct {
+	domain, path, name string
+}
+
+// CookieJar is a cookie jar, whose cookies can be saved and restored later on.
+type CookieJar struct {
+	jar     *cookiejar.Jar
+	mu      sync.Mutex
+	cookies map[cookieKey]SavedCookie
+}
+
+func NewCookieJar() *CookieJar {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		panic(err) // cannot happen
+	}
+	return &CookieJar{jar: jar, cookies: map[cookieKey]SavedCookie{}}
+}
+
+// defaultPath returns the path a cookie without 'Path' attribute is valid for.
+func defaultPath(path string) string {
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 {
+		return "/"
+	}
+	return path[:idx]
+}
+
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		key := cookieKey{c.Domain, c.Path, c.Name}
+		if key.domain == "" {
+			key.domain = u.Hostname()
+		}
+		if key.path == "" {
+			key.path = defaultPath(u.Path)
+		}
+
+		saved := SavedCookie{Url: u.String(), Cookie: *c}
+		if c.MaxAge > 0 {
+			// a relative lifetime does not survive storing
+			saved.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+
+		if c.MaxAge < 0 || (!saved.Expires.IsZero() && saved.Expires.Before(now)) {
+			delete(j.cookies, key)
+		} else {
+			j.cookies[key] = saved
+		}
+	}
+}
+
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// Load restores previously saved cookies.
+func (j *CookieJar) Load(cookies []SavedCookie) {
+	for _, c := range cookies {
+		u, err := url.Parse(c.Url)
+		if err != nil {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{&c.Cookie})
+	}
+}
+
+// Saved returns all cookies that have not expired yet.
+func (j *CookieJar) Saved() []SavedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	cookies := make([]SavedCookie, 0, len(j.cookies))
+	for key, c := range j.cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies
+}
@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieJar(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", MaxAge: 3600})
+		http.SetCookie(w, &http.Cookie{Name: "gone", Value: "x", MaxAge: -1})
+		http.Redirect(w, r, "/feed", http.StatusFound)
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "abc" {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("feed"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if _, _, err := Get(srv.URL+"/feed", Context{Timeout: 5, Jar: NewCookieJar()}); err == nil {
+		t.Fatal("Expected an error without session cookie")
+	}
+
+	jar := NewCookieJar()
+	_, cancel, err := Get(srv.URL+"/login", Context{Timeout: 5, Jar: jar})
+	if err != nil {
+		t.Fatalf("Cookie has not been sent along the redirect: %s", err)
+	}
+	cancel()
+
+	saved := jar.Saved()
+	if len(saved) != 1 || saved[0].Name != "session" || saved[0].MaxAge != 0 || saved[0].Expires.IsZero() {
+		t.Fatalf("Unexpected saved cookies: %+v", saved)
+	}
+
+	// a new jar with the saved cookies
+	restored := NewCookieJar()
+	restored.Load(saved)
+	_, cancel, err = Get(srv.URL+"/feed", Context{Timeout: 5, Jar: restored})
+	if err != nil {
+		t.Fatalf("Restored cookie has not been sent: %s", err)
+	}
+	cancel()
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Credentials (and additional headers) of a feed. They are only sent to the host of the feed,
+// neither to other hosts serving images or articles nor to redirect targets.
+type Credentials struct {
+	Host     string
+	Header   http.Header
+	User     string
+	Password string
+	Token    string // bearer token
+}
+
+type credentialsKey struct{}
+
+func (c *Credentials) matches(u *url.URL) bool {
+	return strings.EqualFold(u.Hostname(), c.Host)
+}
+
+func (c *Credentials) apply(req *http.Request) {
+	if !c.matches(req.URL) {
+		return
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.User != "" || c.Password != "":
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
+// strip removes the credentials from a request, which is redirected to another host.
+func (c *Credentials) strip(req *http.Request) {
+	if c.matches(req.URL) {
+		return
+	}
+	for name := range c.Header {
+		req.Header.Del(name)
+	}
+	req.Header.Del("Authorization")
+}
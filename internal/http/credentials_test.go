@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCredentials(t *testing.T) {
+	type seen struct{ ApiKey, Authorization string }
+	var got []seen
+	record := func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, seen{r.Header.Get("X-Api-Key"), r.Header.Get("Authorization")})
+		_, _ = w.Write([]byte("ok"))
+	}
+
+	other := httptest.NewServer(http.HandlerFunc(record))
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed", record)
+	mux.Handle("/moved", http.RedirectHandler("/feed", http.StatusFound))
+	mux.Handle("/away", http.RedirectHandler(other.URL+"/feed", http.StatusFound))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// the feed is on 'localhost', the other server on '127.0.0.1'
+	feedUrl := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	basic := &Credentials{Host: "localhost", Header: http.Header{"X-Api-Key": {"key"}}, User: "me", Password: "pw"}
+	bearer := &Credentials{Host: "localhost", Token: "token"}
+
+	tests := []struct {
+		name  string
+		url   string
+		creds *Credentials
+		want  []seen
+	}{
+		{"None", feedUrl + "/feed", nil, []seen{{}}},
+		{"Basic", feedUrl + "/feed", basic, []seen{{"key", "Basic bWU6cHc="}}},
+		{"Bearer", feedUrl + "/feed", bearer, []seen{{"", "Bearer token"}}},
+		{"Other Host", other.URL + "/feed", basic, []seen{{}}},
+		{"Redirect", feedUrl + "/moved", basic, []seen{{"key", "Basic bWU6cHc="}}},
+		{"Redirect to Other Host", feedUrl + "/away", basic, []seen{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			_, cancel, err := Get(tt.url, Context{Timeout: 5, Credentials: tt.creds})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
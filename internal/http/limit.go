@@ -0,0 +1,68 @@
+package http
+
+import (
+	"strings"
+	"sync"
+)
+
+// limiter bounds the number of concurrent requests, in total and per host. A limit of 0 means no limit.
+type limiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	total   int
+	perHost int
+	active  int
+	hosts   map[string]int
+}
+
+func newLimiter() *limiter {
+	l := &limiter{hosts: map[string]int{}}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// shared by feed, image, and article requests
+var limits = newLimiter()
+
+// SetLimits sets the maximal number of concurrent requests, in total and per host. 0 disables the respective limit.
+// Changed limits also apply to requests already waiting.
+func SetLimits(total, perHost int) {
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+
+	limits.total = total
+	limits.perHost = perHost
+	limits.cond.Broadcast()
+}
+
+func (l *limiter) available(host string) bool {
+	return (l.total <= 0 || l.active < l.total) &&
+		(l.perHost <= 0 || l.hosts[host] < l.perHost)
+}
+
+// acquire blocks until a request to host is allowed. The returned function must be called, when the request is done.
+func (l *limiter) acquire(host string) (release func()) {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	for !l.available(host) {
+		l.cond.Wait()
+	}
+	l.active++
+	l.hosts[host]++
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.active--
+			if l.hosts[host]--; l.hosts[host] <= 0 {
+				delete(l.hosts, host)
+			}
+			l.cond.Broadcast()
+		})
+	}
+}
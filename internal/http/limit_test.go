@@ -0,0 +1,139 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acquired reports whether acquire returns within a short time.
+func acquired(l *limiter, host string) (func(), bool) {
+	done := make(chan func(), 1)
+	go func() { done <- l.acquire(host) }()
+
+	select {
+	case release := <-done:
+		return release, true
+	case <-time.After(50 * time.Millisecond):
+		return func() { (<-done)() }, false
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter()
+	l.total, l.perHost = 2, 1
+
+	releaseA, ok := acquired(l, "a.example")
+	if !ok {
+		t.Fatal("First request must not block")
+	}
+	if _, ok = acquired(l, "A.example"); ok {
+		t.Fatal("Second request to the same host must block")
+	}
+	// the blocked request has taken the slot of host 'a' now
+	releaseA()
+	time.Sleep(10 * time.Millisecond)
+
+	releaseB, ok := acquired(l, "b.example")
+	if !ok {
+		t.Fatal("Request to another host must not block")
+	}
+	releaseC, ok := acquired(l, "c.example")
+	if ok {
+		t.Fatal("Total limit must be respected")
+	}
+
+	releaseB()
+	releaseC()
+	releaseB() // releasing twice has no effect
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active != 1 || len(l.hosts) != 1 {
+		t.Errorf("Unexpected state after releasing: %d active, hosts %v", l.active, l.hosts)
+	}
+}
+
+func TestGetLimit(t *testing.T) {
+	var current, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	SetLimits(0, 2)
+	defer SetLimits(0, 0)
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Go(func() {
+			_, cancel, err := Get(srv.URL, Context{Timeout: 5})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			cancel()
+		})
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Expected at most 2 concurrent requests (and using them), got %d", p)
+	}
+}
+
+func TestGetLimit_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cached":
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	SetLimits(16, 2)
+	defer SetLimits(0, 0)
+
+	// each failed request must give back its slot, else the third one blocks forever
+	for i := range 6 {
+		done := make(chan error, 1)
+		go func() {
+			var err error
+			if i%2 == 0 {
+				_, _, err = GetConditional(srv.URL+"/cached", Context{Timeout: 5}, Validators{ETag: `"x"`})
+			} else {
+				_, _, err = Get(srv.URL+"/missing", Context{Timeout: 5})
+			}
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("Request %d: expected an error", i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Request %d blocked", i)
+		}
+	}
+
+	limits.mu.Lock()
+	defer limits.mu.Unlock()
+	if limits.active != 0 {
+		t.Errorf("%d requests still active", limits.active)
+	}
+}
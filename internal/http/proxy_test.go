@@ -0,0 +1,73 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateProxy(t *testing.T) {
+	tests := []struct {
+		proxy   string
+		wantErr bool
+	}{
+		{"", false},
+		{DirectProxy, false},
+		{"http://proxy.example.net:3128", false},
+		{"https://user:pw@proxy.example.net", false},
+		{"socks5://127.0.0.1:1080", false},
+		{"socks5h://127.0.0.1:9050", false},
+		{"ftp://proxy.example.net", true},
+		{"proxy.example.net:3128", true},
+		{"http://[::1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.proxy, func(t *testing.T) {
+			if err := ValidateProxy(tt.proxy); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateProxy(%q) error = %v, wantErr %v", tt.proxy, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		_, _ = w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	resp, cancel, err := Get("http://feed.invalid/feed.xml", Context{Timeout: 5, Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "proxied" || requested != "http://feed.invalid/feed.xml" {
+		t.Errorf("Request has not been proxied: got %q for %q", body, requested)
+	}
+}
+
+func TestClientSharing(t *testing.T) {
+	get := func(ctx Context) *http.Client {
+		c, err := client(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if get(Context{Proxy: "socks5://127.0.0.1:1080"}) != get(Context{Proxy: "socks5://127.0.0.1:1080"}) {
+		t.Error("Same settings should share the client")
+	}
+	if get(Context{}) == get(Context{DisableTLS: true}) {
+		t.Error("Different TLS settings must not share the client")
+	}
+	if get(Context{}) == get(Context{Proxy: DirectProxy}) {
+		t.Error("Different proxies must not share the client")
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func writePem(t *testing.T, path, typ string, data []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// selfSigned creates a self-signed certificate with the given usage.
+func selfSigned(t *testing.T, name string, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// clientCert creates a self-signed client certificate and writes it (and its key) into dir.
+func clientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	cert, key := selfSigned(t, "feed2imap-go test client", x509.ExtKeyUsageClientAuth)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert,
+		writePem(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", cert.Raw),
+		writePem(t, filepath.Join(dir, "client.key"), "PRIVATE KEY", keyDer)
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, certFile, keyFile := clientCert(t, dir)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	srv := httptest.NewTLSServer(handler)
+	defer srv.Close()
+
+	mtls := httptest.NewUnstartedServer(handler)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	mtls.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtls.StartTLS()
+	defer mtls.Close()
+
+	ca := writePem(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", srv.Certificate().Raw)
+	mtlsCa := writePem(t, filepath.Join(dir, "mtls-ca.pem"), "CERTIFICATE", mtls.Certificate().Raw)
+	pin := config.SPKIHash(srv.Certificate())
+	otherPin := config.SPKIHash(cert)
+
+	tests := []struct {
+		name     string
+		url      string
+		tls      config.TLS
+		insecure bool
+		wantErr  bool
+	}{
+		{name: "Unknown CA", url: srv.URL, wantErr: true},
+		{name: "Insecure", url: srv.URL, insecure: true},
+		{name: "CA", url: srv.URL, tls: config.TLS{CA: ca}},
+		{name: "CA and Pin", url: srv.URL, tls: config.TLS{CA: ca, Pins: []string{otherPin, "sha256/" + pin}}},
+		{name: "Wrong Pin", url: srv.URL, tls: config.TLS{CA: ca, Pins: []string{otherPin}}, wantErr: true},
+		{name: "Pin only", url: srv.URL, tls: config.TLS{Pins: []string{pin}}, insecure: true},
+		{name: "Wrong Pin only", url: srv.URL, tls: config.TLS{Pins: []string{otherPin}}, insecure: true, wantErr: true},
+		{name: "No Client Cert", url: mtls.URL, tls: config.TLS{CA: mtlsCa}, wantErr: true},
+		{name: "Client Cert", url: mtls.URL, tls: config.TLS{CA: mtlsCa, Cert: certFile, Key: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cancel, err := Get(tt.url, Context{Timeout: 5, TLS: tt.tls, DisableTLS: tt.insecure})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				cancel()
+			}
+		})
+	}
+}
+
+// TestTLSPinAppended checks that the pins cannot be satisfied by appending the pinned certificate to another chain.
+func TestTLSPinAppended(t *testing.T) {
+	dir := t.TempDir()
+
+	pinned := httptest.NewTLSServer(http.NotFoundHandler())
+	defer pinned.Close()
+	pin := config.SPKIHash(pinned.Certificate())
+
+	leaf, key := selfSigned(t, "feed2imap-go test server", x509.ExtKeyUsageServerAuth)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.Raw, pinned.Certificate().Raw},
+		PrivateKey:  key,
+	}}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	ca := writePem(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", leaf.Raw)
+
+	tests := []struct {
+		name     string
+		tls      config.TLS
+		insecure bool
+	}{
+		{"Verified", config.TLS{CA: ca, Pins: []string{pin}}, false},
+		{"Pin only", config.TLS{Pins: []string{pin}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cancel, err := Get(srv.URL, Context{Timeout: 5, TLS: tt.tls, DisableTLS: tt.insecure})
+			if err == nil {
+				cancel()
+				t.Fatal("Pinned certificate appended to the chain was accepted")
+			}
+		})
+	}
+
+	// sanity check: the leaf itself is accepted
+	_, cancel, err := Get(srv.URL, Context{Timeout: 5, TLS: config.TLS{CA: ca, Pins: []string{config.SPKIHash(leaf)}}})
+	if err != nil {
+		t.Fatalf("Pinned leaf was rejected: %v", err)
+	}
+	cancel()
+}
+
+func TestTLSInvalid(t *testing.T) {
+	dir := t.TempDir()
+	noCert := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(noCert, []byte("nothing"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, settings := range []config.TLS{
+		{CA: filepath.Join(dir, "missing.pem")},
+		{CA: noCert},
+		{Cert: noCert},
+		{Key: noCert},
+		{Pins: []string{"not base64"}},
+		{Pins: []string{"c2hvcnQ="}},
+	} {
+		if _, err := settings.Build(false); err == nil {
+			t.Errorf("Build() should fail for %+v", settings)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package imap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	imapClient "github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+const tokenTimeout = 30 * time.Second
+
+// password returns the password or token to log in with. Commands and files are consulted anew each time.
+func password(u config.Url) (string, error) {
+	auth := u.Auth
+	switch {
+	case auth.OAuth2 != nil:
+		return oauthToken(auth.OAuth2)
+	case len(auth.Command) > 0:
+		out, err := auth.Command.Output()
+		if err != nil {
+			return "", fmt.Errorf("auth command: %w", err)
+		}
+		return out, nil
+	case auth.File != "":
+		content, err := os.ReadFile(auth.File)
+		if err != nil {
+			return "", fmt.Errorf("reading auth file: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	default:
+		return string(u.Password), nil
+	}
+}
+
+type accessToken struct {
+	token   string
+	refresh string // the refresh token, if the server replaced it
+	expiry  time.Time
+}
+
+// tokenEntry holds the access token of one OAuth2 configuration. It is locked while the token is refreshed,
+// so that concurrent logins wait for the new token instead of refreshing it again.
+type tokenEntry struct {
+	sync.Mutex
+	token *accessToken
+}
+
+// tokens caches the access tokens for the lifetime of the process.
+var tokens = struct {
+	sync.Mutex
+	m map[config.OAuth2]*tokenEntry
+}{m: make(map[config.OAuth2]*tokenEntry)}
+
+func tokenEntryOf(cfg *config.OAuth2) *tokenEntry {
+	tokens.Lock()
+	defer tokens.Unlock()
+
+	entry := tokens.m[*cfg]
+	if entry == nil {
+		entry = &tokenEntry{}
+		tokens.m[*cfg] = entry
+	}
+	return entry
+}
+
+// oauthToken returns a valid access token, refreshing it if it is (about to be) expired.
+func oauthToken(cfg *config.OAuth2) (string, error) {
+	entry := tokenEntryOf(cfg)
+	entry.Lock()
+	defer entry.Unlock()
+
+	cached := entry.token
+	if cached != nil && time.Now().Before(cached.expiry) {
+		return cached.token, nil
+	}
+
+	var refresh string
+	if cached != nil && cached.refresh != "" {
+		refresh = cached.refresh
+	} else {
+		refresh = loadRefreshToken(cfg)
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refresh},
+		"client_id":     {cfg.ClientId},
+	}
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", string(cfg.ClientSecret))
+	}
+	if cfg.Scope != "" {
+		form.Set("scope", cfg.Scope)
+	}
+
+	client := http.Client{Timeout: tokenTimeout}
+	resp, err := client.PostForm(cfg.TokenUrl, form)
+	if err != nil {
+		return "", fmt.Errorf("refreshing OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Error        string `json:"error"`
+		Description  string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&answer); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("refreshing OAuth2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || answer.AccessToken == "" {
+		if answer.Error != "" {
+			return "", fmt.Errorf("refreshing OAuth2 token: %s (%s)", answer.Error, answer.Description)
+		}
+		return "", fmt.Errorf("refreshing OAuth2 token: %s", resp.Status)
+	}
+
+	token := &accessToken{token: answer.AccessToken, refresh: answer.RefreshToken}
+	if token.refresh != "" && token.refresh != refresh {
+		// the old token may be revoked now, so the new one is needed for the next run
+		if err = storeRefreshToken(cfg, token.refresh); err != nil {
+			log.Warnf("Storing the new OAuth2 refresh token: %s. The next run might fail to log in.", err)
+		}
+	}
+	if answer.ExpiresIn > 0 {
+		// some leeway for the time until the token is actually used
+		token.expiry = time.Now().Add(time.Duration(answer.ExpiresIn)*time.Second - time.Minute)
+	}
+	if token.refresh == "" && cached != nil {
+		token.refresh = cached.refresh
+	}
+	entry.token = token
+
+	log.Debugf("Refreshed OAuth2 token from %s", cfg.TokenUrl)
+	return token.token, nil
+}
+
+// refreshTokenFile returns where a replaced refresh token is stored. The default location depends on the
+// configured refresh token, so that a new one in the configuration takes precedence.
+func refreshTokenFile(cfg *config.OAuth2) string {
+	if cfg.TokenFile != "" {
+		return cfg.TokenFile
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cfg.TokenUrl + "\x00" + cfg.ClientId + "\x00" + string(cfg.RefreshToken)))
+	return filepath.Join(dir, "feed2imap-go", "oauth2-"+hex.EncodeToString(sum[:8]))
+}
+
+// loadRefreshToken returns the refresh token stored by a previous run, or the configured one.
+func loadRefreshToken(cfg *config.OAuth2) string {
+	if file := refreshTokenFile(cfg); file != "" {
+		content, err := os.ReadFile(file)
+		if err == nil {
+			if token := strings.TrimSpace(string(content)); token != "" {
+				return token
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("Reading OAuth2 refresh token: %s", err)
+		}
+	}
+	return string(cfg.RefreshToken)
+}
+
+func storeRefreshToken(cfg *config.OAuth2, token string) error {
+	file := refreshTokenFile(cfg)
+	if file == "" {
+		return errors.New("no location to store it")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".oauth2-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(token + "\n"); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+
+	log.Debugf("Stored new OAuth2 refresh token in %s", file)
+	return nil
+}
+
+func saslClient(u config.Url, password string) (sasl.Client, error) {
+	switch u.Auth.Mechanism {
+	case config.MechPlain:
+		return sasl.NewPlainClient("", u.User, password), nil
+	case config.MechScramSha1:
+		return newScramSha1Client(u.User, password), nil
+	case config.MechScramSha256:
+		return newScramSha256Client(u.User, password), nil
+	case config.MechXOAuth2:
+		return &xoauth2Client{u.User, password}, nil
+	case config.MechOAuthBearer:
+		port, _ := strconv.Atoi(u.Port)
+		return sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+			Username: u.User,
+			Token:    password,
+			Host:     u.Host,
+			Port:     port,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown auth mechanism '%s'", u.Auth.Mechanism)
+	}
+}
+
+// supportedMechanisms lists the SASL mechanisms advertised by the server.
+func supportedMechanisms(c *imapClient.Client) []string {
+	caps, err := c.Capability()
+	if err != nil {
+		return nil
+	}
+	var mechs []string
+	for capability := range caps {
+		if mech, ok := strings.CutPrefix(capability, "AUTH="); ok {
+			mechs = append(mechs, mech)
+		}
+	}
+	slices.Sort(mechs)
+	return mechs
+}
+
+// login authenticates with the mechanism configured for the url.
+// The capabilities of the server are checked first, as obtaining the password may run commands or refresh tokens.
+func login(c *imapClient.Client, u config.Url) error {
+	if u.Auth.Mechanism == "" || u.Auth.Mechanism == config.MechLogin {
+		if disabled, err := c.Support("LOGINDISABLED"); err != nil {
+			return err
+		} else if disabled {
+			return imapClient.ErrLoginDisabled
+		}
+
+		pw, err := password(u)
+		if err != nil {
+			return err
+		}
+		return c.Login(u.User, pw)
+	}
+
+	mech := strings.ToUpper(u.Auth.Mechanism)
+	if ok, err := c.SupportAuth(mech); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("server does not support %s, only: %s", mech, strings.Join(supportedMechanisms(c), ", "))
+	}
+
+	pw, err := password(u)
+	if err != nil {
+		return err
+	}
+	auth, err := saslClient(u, pw)
+	if err != nil {
+		return err
+	}
+	return c.Authenticate(auth)
+}
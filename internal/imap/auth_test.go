@@ -0,0 +1,200 @@
+package imap
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	imapClient "github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func TestPassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  config.Url
+		want string
+	}{
+		{"Plain", config.Url{Password: "secret"}, "secret"},
+		{"Command", config.Url{Auth: config.Login{Command: []string{"echo", "from-command"}}}, "from-command"},
+		{"File", config.Url{Auth: config.Login{File: file}}, "from-file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := password(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("password() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := password(config.Url{Auth: config.Login{Command: []string{"false"}}}); err == nil {
+		t.Error("Failing command not reported")
+	}
+}
+
+func TestOAuthToken(t *testing.T) {
+	var refreshTokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshTokens = append(refreshTokens, r.PostFormValue("refresh_token"))
+		if r.PostFormValue("client_id") != "id" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access" + r.PostFormValue("refresh_token"),
+			"refresh_token": "rotated",
+			"expires_in":    3600,
+		})
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	cfg := &config.OAuth2{TokenUrl: srv.URL, ClientId: "id", RefreshToken: "initial", TokenFile: tokenFile}
+	for range 2 {
+		token, err := oauthToken(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "accessinitial" {
+			t.Errorf("Unexpected token %q", token)
+		}
+	}
+
+	// expired: refreshed with the rotated token
+	tokens.m[*cfg].token.expiry = time.Now()
+	if token, err := oauthToken(cfg); err != nil || token != "accessrotated" {
+		t.Errorf("Unexpected token %q, %v", token, err)
+	}
+	if strings.Join(refreshTokens, ",") != "initial,rotated" {
+		t.Errorf("Unexpected refreshes: %v", refreshTokens)
+	}
+
+	// the next run continues with the rotated token
+	if content, err := os.ReadFile(tokenFile); err != nil || string(content) != "rotated\n" {
+		t.Errorf("Unexpected token file %q, %v", content, err)
+	}
+	delete(tokens.m, *cfg)
+	if token, err := oauthToken(cfg); err != nil || token != "accessrotated" {
+		t.Errorf("Unexpected token in next run %q, %v", token, err)
+	}
+
+	// default location, depending on the configured token
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	other := &config.OAuth2{TokenUrl: srv.URL, ClientId: "id", RefreshToken: "other"}
+	if _, err := oauthToken(other); err != nil {
+		t.Fatal(err)
+	}
+	if token := loadRefreshToken(other); token != "rotated" {
+		t.Errorf("Token not stored at default location: %q", token)
+	}
+	if token := loadRefreshToken(&config.OAuth2{TokenUrl: srv.URL, ClientId: "id", RefreshToken: "new"}); token != "new" {
+		t.Errorf("Newly configured token not used: %q", token)
+	}
+
+	if _, err := oauthToken(&config.OAuth2{TokenUrl: srv.URL, ClientId: "other", RefreshToken: "x"}); err == nil ||
+		!strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestOAuthToken_Concurrent(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "slow"})
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "fast"})
+	}))
+	defer fast.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := oauthToken(&config.OAuth2{TokenUrl: slow.URL, ClientId: "id", RefreshToken: "slow"})
+		done <- err
+	}()
+	<-arrived
+
+	// not blocked by the refresh running for the other configuration
+	if token, err := oauthToken(&config.OAuth2{TokenUrl: fast.URL, ClientId: "id", RefreshToken: "fast"}); err != nil || token != "fast" {
+		t.Errorf("Unexpected token %q, %v", token, err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// testServer starts an in-memory IMAP server and returns its address.
+// It knows the user 'username' with password 'password'.
+func testServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Close() })
+	return l.Addr().String()
+}
+
+func TestLogin(t *testing.T) {
+	addr := testServer(t)
+
+	tests := []struct {
+		name    string
+		auth    config.Login
+		pw      string
+		wantErr string
+	}{
+		{"Login", config.Login{}, "password", ""},
+		{"Plain", config.Login{Mechanism: config.MechPlain}, "password", ""},
+		{"Plain wrong password", config.Login{Mechanism: config.MechPlain}, "wrong", "Bad username or password"},
+		{"Unsupported", config.Login{Mechanism: config.MechXOAuth2}, "token", "server does not support XOAUTH2, only: PLAIN"},
+		{"Unsupported before command", config.Login{Mechanism: config.MechXOAuth2, Command: config.Command{"false"}}, "",
+			"server does not support XOAUTH2"},
+		{"Failing command", config.Login{Mechanism: config.MechPlain, Command: config.Command{"false"}}, "", "auth command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := imapClient.Dial(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Logout()
+
+			err = login(c, config.Url{User: "username", Password: config.Secret(tt.pw), Auth: tt.auth})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
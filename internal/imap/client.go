@@ -1,6 +1,8 @@
 package imap
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -9,6 +11,7 @@ import (
 	uidplus "github.com/emersion/go-imap-uidplus"
 	imapClient "github.com/emersion/go-imap/client"
 
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 )
@@ -21,6 +24,7 @@ type connConf struct {
 
 type Client struct {
 	connConf
+	url          config.Url
 	mailboxes    *mailboxes
 	commander    *commander
 	connections  []*connection
@@ -29,15 +33,19 @@ type Client struct {
 	disconnected bool
 }
 
+var _ sink.Sink = (*Client)(nil)
+
+var errDisconnected = errors.New("client is disconnected")
+
 var dialer imapClient.Dialer
 
 func init() {
 	dialer = &net.Dialer{Timeout: 30 * time.Second}
 }
 
-func newImapClient(url config.Url) (c *imapClient.Client, err error) {
+func newImapClient(url config.Url, tlsConfig *tls.Config) (c *imapClient.Client, err error) {
 	if url.ForceTLS() {
-		if c, err = imapClient.DialWithDialerTLS(dialer, url.HostPort(), nil); err != nil {
+		if c, err = imapClient.DialWithDialerTLS(dialer, url.HostPort(), tlsConfig); err != nil {
 			return nil, fmt.Errorf("connecting (TLS) to %s: %w", url.Host, err)
 		}
 		log.Print("Connected to ", url.HostPort(), " (TLS)")
@@ -50,8 +58,56 @@ func newImapClient(url config.Url) (c *imapClient.Client, err error) {
 	return
 }
 
-func (cl *Client) connect(url config.Url) (*connection, error) {
-	c, err := newImapClient(url)
+func startTls(c *imapClient.Client, host string, tlsConfig *tls.Config) error {
+	hasStartTls, err := c.SupportStartTLS()
+	if err != nil {
+		return fmt.Errorf("checking for starttls for %s: %w", host, err)
+	}
+
+	if hasStartTls {
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("enabling starttls for %s: %w", host, err)
+		}
+
+		log.Print("Connected to ", host, " (STARTTLS)")
+	} else {
+		log.Print("Connected to ", host, " (Plain)")
+	}
+
+	return nil
+}
+
+// dial opens a new connection to the server and logs in.
+func (cl *Client) dial() (*client, error) {
+	url := cl.url
+
+	tlsConfig, err := url.TLS.Build(false)
+	if err != nil {
+		return nil, fmt.Errorf("TLS settings for %s: %w", url.Host, err)
+	}
+
+	c, err := newImapClient(url, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if !url.ForceTLS() {
+		if err = startTls(c, url.Host, tlsConfig); err != nil {
+			_ = c.Terminate()
+			return nil, err
+		}
+	}
+
+	if err = login(c, url); err != nil {
+		_ = c.Logout()
+		return nil, fmt.Errorf("login to %s: %w", url.Host, err)
+	}
+
+	return &client{c, uidplus.NewClient(c)}, nil
+}
+
+func (cl *Client) connect() (*connection, error) {
+	c, err := cl.dial()
 	if err != nil {
 		return nil, err
 	}
@@ -60,24 +116,49 @@ func (cl *Client) connect(url config.Url) (*connection, error) {
 	defer cl.connLock.Unlock()
 
 	if cl.disconnected {
+		_ = c.Logout()
 		return nil, nil
 	}
 
 	conn := cl.createConnection(c)
+	cl.connChannel <- conn
 
-	if !url.ForceTLS() {
-		if err = conn.startTls(); err != nil {
-			return nil, err
+	return conn, nil
+}
+
+// connectRetrying is connect, but tries again a few times before giving up.
+func (cl *Client) connectRetrying() (conn *connection, err error) {
+	for attempt := 1; ; attempt++ {
+		if conn, err = cl.connect(); err == nil || attempt == maxAttempts {
+			return
 		}
+		log.Debugf("Connecting to %s failed (attempt %d): %s", cl.host, attempt, err)
+		time.Sleep(time.Duration(attempt) * retryDelay)
 	}
+}
 
-	if err = c.Login(url.User, url.Password); err != nil {
-		return nil, fmt.Errorf("login to %s: %w", url.Host, err)
+// reconnect replaces the broken IMAP client of the connection by a new one.
+func (cl *Client) reconnect(conn *connection) error {
+	_ = conn.c.Terminate()
+
+	c, err := cl.dial()
+	if err != nil {
+		return fmt.Errorf("reconnecting to %s: %w", cl.host, err)
 	}
 
-	cl.connChannel <- conn
+	cl.connLock.Lock()
+	defer cl.connLock.Unlock()
 
-	return conn, nil
+	if cl.disconnected {
+		_ = c.Logout()
+		return errDisconnected
+	}
+
+	conn.c = c
+	conn.lastUsed = time.Now()
+	log.Print("Reconnected to ", cl.host)
+
+	return nil
 }
 
 func (cl *Client) Disconnect() {
@@ -102,22 +183,21 @@ func (cl *Client) Disconnect() {
 	}
 }
 
-func (cl *Client) createConnection(c *imapClient.Client) *connection {
-
-	client := &client{c, uidplus.NewClient(c)}
-
+func (cl *Client) createConnection(c *client) *connection {
 	conn := &connection{
 		connConf:  &cl.connConf,
 		mailboxes: cl.mailboxes,
-		c:         client,
+		c:         c,
+		lastUsed:  time.Now(),
 	}
 
 	cl.connections = append(cl.connections, conn)
 	return conn
 }
 
-func newClient() *Client {
+func newClient(url config.Url) *Client {
 	return &Client{
+		url:         url,
 		mailboxes:   NewMailboxes(),
 		connChannel: make(chan *connection, 0),
 	}
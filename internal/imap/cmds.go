@@ -1,5 +1,11 @@
 package imap
 
+import (
+	"slices"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+)
+
 type ensureCommando struct {
 	folder Folder
 }
@@ -8,21 +14,64 @@ func (cmd ensureCommando) execute(conn *connection) error {
 	return conn.ensureFolder(cmd.folder)
 }
 
-func (cl *Client) EnsureFolder(folder Folder) error {
-	return cl.commander.execute(ensureCommando{folder})
+func (ensureCommando) retryable() bool { return true }
+
+func (cl *Client) EnsureFolder(folder sink.Folder) error {
+	return cl.commander.execute(ensureCommando{asFolder(folder)})
 }
 
 type addCommando struct {
-	folder   Folder
-	messages []string
+	folder      Folder
+	messages    []string
+	locations   []sink.Location // result; also marks the messages already stored
+	interrupted bool            // the last attempt failed, the message(s) being uploaded may have been stored anyway
+}
+
+func (cmd *addCommando) execute(conn *connection) error {
+	if cmd.interrupted {
+		if err := cmd.skipStored(conn); err != nil {
+			return err
+		}
+		cmd.interrupted = false
+	}
+
+	locations, err := conn.putMessages(cmd.folder, cmd.messages[len(cmd.locations):])
+	cmd.locations = append(cmd.locations, locations...)
+	cmd.interrupted = err != nil
+	return err
 }
 
-func (cmd addCommando) execute(conn *connection) error {
-	return conn.putMessages(cmd.folder, cmd.messages)
+// skipStored records the messages, that have been stored by the interrupted attempt, as done.
+// This is the message being uploaded, or the whole batch in case of MULTIAPPEND. Thus the remaining
+// messages are checked until the first one, which is not found in the folder.
+func (cmd *addCommando) skipStored(conn *connection) error {
+	status, err := conn.selectFolder(cmd.folder)
+	if err != nil {
+		return err
+	}
+
+	for len(cmd.locations) < len(cmd.messages) {
+		loc, err := conn.findMessage(cmd.folder, status, cmd.messages[len(cmd.locations)])
+		if err != nil || loc == nil {
+			return err
+		}
+		cmd.locations = append(cmd.locations, *loc)
+	}
+	return nil
 }
 
-func (cl *Client) PutMessages(folder Folder, messages []string) error {
-	return cl.commander.execute(addCommando{folder, messages})
+// retryable, as it continues after the messages stored -- also those whose confirmation got lost.
+// These are found by their Message-Id, so without one, it is unknown whether they have been stored.
+func (cmd *addCommando) retryable() bool {
+	return !cmd.interrupted || !slices.ContainsFunc(cmd.messages[len(cmd.locations):], func(msg string) bool {
+		return messageId(msg) == ""
+	})
+}
+
+func (cl *Client) PutMessages(folder sink.Folder, messages []string) ([]sink.Location, error) {
+	cmd := &addCommando{folder: asFolder(folder), messages: messages}
+	err := cl.commander.execute(cmd)
+	return cmd.locations, err
 }
 
 type replaceCommando struct {
@@ -31,12 +80,26 @@ type replaceCommando struct {
 	value      string
 	newContent string
 	force      bool
+	location   sink.Location // old location on input, new one as result
+	deleting   bool          // an interrupted attempt may have deleted the old message already
 }
 
-func (cmd replaceCommando) execute(conn *connection) error {
-	return conn.replace(cmd.folder, cmd.header, cmd.value, cmd.newContent, cmd.force)
+func (cmd *replaceCommando) execute(conn *connection) error {
+	// once the old message may be gone, not finding it must not stop the upload of the new one
+	force := cmd.force || cmd.deleting
+	location, err := conn.replace(cmd.folder, cmd.header, cmd.value, cmd.newContent, force, cmd.location, &cmd.deleting)
+	if err == nil {
+		cmd.location = location
+	}
+	return err
 }
 
-func (cl *Client) Replace(folder Folder, header, value, newContent string, force bool) error {
-	return cl.commander.execute(replaceCommando{folder, header, value, newContent, force})
+// retryable, as the old message is searched again -- or the new one, if its confirmation got lost,
+// which is then replaced by itself.
+func (*replaceCommando) retryable() bool { return true }
+
+func (cl *Client) Replace(folder sink.Folder, header, value, newContent string, force bool, old sink.Location) (sink.Location, error) {
+	cmd := &replaceCommando{folder: asFolder(folder), header: header, value: value, newContent: newContent, force: force, location: old}
+	err := cl.commander.execute(cmd)
+	return cmd.location, err
 }
@@ -1,6 +1,20 @@
 package imap
 
-const maxPipeDepth = 10
+import (
+	"errors"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+const (
+	maxPipeDepth = 10
+	maxAttempts  = 3 // per command and per connection attempt
+	idleCheck    = time.Minute
+)
+
+// delay before the next attempt, multiplied by the number of attempts so far
+var retryDelay = time.Second
 
 type commander struct {
 	client *Client
@@ -12,6 +26,17 @@ type command interface {
 	execute(*connection) error
 }
 
+// retryable is implemented by commands that may be executed again,
+// when the connection broke while they were running. It is asked after each failed attempt.
+type retryable interface {
+	retryable() bool
+}
+
+func canRetry(cmd command) bool {
+	r, ok := cmd.(retryable)
+	return ok && r.retryable()
+}
+
 type execution struct {
 	cmd  command
 	done chan<- error
@@ -23,7 +48,7 @@ func (commander *commander) execute(command command) error {
 	return <-done
 }
 
-func executioner(conn *connection, pipe <-chan execution, done <-chan struct{}) {
+func (cl *Client) executioner(conn *connection, pipe <-chan execution, done <-chan struct{}) {
 	for {
 		select {
 		case <-done:
@@ -34,12 +59,43 @@ func executioner(conn *connection, pipe <-chan execution, done <-chan struct{})
 				return
 			default:
 			}
-			err := execution.cmd.execute(conn)
+			err := cl.run(conn, execution.cmd)
 			execution.done <- err
 		}
 	}
 }
 
+// run executes the command, making sure it is run on a working connection.
+// If the connection breaks during the command, it is re-established and retryable commands are executed again.
+func (cl *Client) run(conn *connection, cmd command) error {
+	for attempt := 1; ; attempt++ {
+		var err error
+		executed := false
+		if !conn.healthy(idleCheck) {
+			log.Warnf("Connection to %s lost, reconnecting", cl.host)
+			err = cl.reconnect(conn)
+		}
+
+		if err == nil {
+			executed = true
+			err = cmd.execute(conn)
+			conn.lastUsed = time.Now()
+
+			if err == nil || conn.healthy(0) {
+				// errors on a healthy connection stem from the server, trying again does not help
+				return err
+			}
+		}
+
+		if errors.Is(err, errDisconnected) || attempt == maxAttempts || (executed && !canRetry(cmd)) {
+			return err
+		}
+
+		log.Warnf("%s. Trying again.", err)
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
 func (cl *Client) startCommander() {
 	if cl.commander != nil {
 		return
@@ -52,7 +108,7 @@ func (cl *Client) startCommander() {
 
 	go func() {
 		for conn := range cl.connChannel {
-			go executioner(conn, pipe, done)
+			go cl.executioner(conn, pipe, done)
 		}
 	}()
 }
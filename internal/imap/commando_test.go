@@ -0,0 +1,210 @@
+package imap
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func testClient(t *testing.T, numConnections int) *Client {
+	t.Helper()
+	host, port, err := net.SplitHostPort(testServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDelay := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = oldDelay })
+
+	url := config.Url{Scheme: "imap", Host: host, Port: port, User: "username", Password: "password"}
+	cl, err := Connect(url, numConnections)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cl.Disconnect)
+	return cl
+}
+
+// breakingCommando breaks the connection on its first execution.
+type breakingCommando struct {
+	calls int
+}
+
+func (cmd *breakingCommando) execute(conn *connection) error {
+	cmd.calls++
+	if cmd.calls == 1 {
+		_ = conn.c.Terminate()
+		<-conn.c.LoggedOut()
+		return errors.New("connection broke")
+	}
+	return conn.c.Noop()
+}
+
+type retryableBreakingCommando struct {
+	breakingCommando
+}
+
+func (*retryableBreakingCommando) retryable() bool { return true }
+
+// failingCommando fails without harming the connection.
+type failingCommando struct {
+	calls int
+}
+
+func (cmd *failingCommando) execute(conn *connection) error {
+	cmd.calls++
+	_, err := conn.c.Select("does-not-exist", false)
+	return err
+}
+
+func (*failingCommando) retryable() bool { return true }
+
+func TestRun(t *testing.T) {
+	cl := testClient(t, 1)
+
+	retrying := &retryableBreakingCommando{}
+	if err := cl.commander.execute(retrying); err != nil {
+		t.Errorf("Retryable command failed: %v", err)
+	}
+	if retrying.calls != 2 {
+		t.Errorf("Retryable command executed %d times, want 2", retrying.calls)
+	}
+
+	once := &breakingCommando{}
+	if err := cl.commander.execute(once); err == nil {
+		t.Error("Non-retryable command did not fail")
+	}
+	if once.calls != 1 {
+		t.Errorf("Non-retryable command executed %d times, want 1", once.calls)
+	}
+
+	// the connection is re-established for the next command
+	failing := &failingCommando{}
+	if err := cl.commander.execute(failing); err == nil {
+		t.Error("Selecting an unknown folder did not fail")
+	}
+	if failing.calls != 1 {
+		t.Errorf("Failing command on a healthy connection executed %d times, want 1", failing.calls)
+	}
+}
+
+func TestRun_Disconnected(t *testing.T) {
+	cl := testClient(t, 1)
+	conn := cl.connections[0]
+
+	_ = conn.c.Terminate()
+	<-conn.c.LoggedOut()
+
+	folder := Folder{str: "INBOX", delimiter: "/"}
+	if _, err := cl.PutMessages(folder, []string{mail("after", "reconnect")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.selectFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "after"); got != "after:1" {
+		t.Errorf("Unexpected messages after reconnect: %s", got)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	conn := testConnection(t)
+
+	conn.lastUsed = time.Now()
+	if !conn.healthy(time.Minute) {
+		t.Error("Fresh connection is not healthy")
+	}
+
+	conn.lastUsed = time.Now().Add(-time.Hour)
+	if !conn.healthy(time.Minute) {
+		t.Error("Idle connection is not healthy")
+	}
+
+	_ = conn.c.Terminate()
+	<-conn.c.LoggedOut()
+	if conn.healthy(time.Minute) {
+		t.Error("Terminated connection is healthy")
+	}
+}
+
+func TestAddCommando_Resume(t *testing.T) {
+	conn := testConnection(t)
+	folder := Folder{str: "INBOX", delimiter: "/"}
+
+	// the first message has been stored by an earlier attempt
+	cmd := &addCommando{
+		folder:    folder,
+		messages:  []string{mail("alpha", "1"), mail("beta", "2")},
+		locations: []sink.Location{{}},
+	}
+	if err := cmd.execute(conn); err != nil {
+		t.Fatal(err)
+	}
+	if len(cmd.locations) != 2 {
+		t.Errorf("Got %d locations, want 2", len(cmd.locations))
+	}
+	if _, err := conn.selectFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "alpha", "beta"); got != "alpha:0,beta:1" {
+		t.Errorf("Unexpected messages: %s", got)
+	}
+}
+
+func TestAddCommando_Retryable(t *testing.T) {
+	noId := "From: foo@example.net\r\n\r\nbody\r\n"
+
+	tests := []struct {
+		name        string
+		messages    []string
+		interrupted bool
+		want        bool
+	}{
+		{"Not interrupted", []string{noId}, false, true},
+		{"With Message-Id", []string{mail("alpha", "1"), mail("beta", "2")}, true, true},
+		{"Without Message-Id", []string{mail("alpha", "1"), noId}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &addCommando{messages: tt.messages, interrupted: tt.interrupted}
+			if got := cmd.retryable(); got != tt.want {
+				t.Errorf("retryable() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceCommando_Resume(t *testing.T) {
+	conn := testConnection(t)
+	folder := Folder{str: "INBOX", delimiter: "/"}
+
+	if _, err := conn.putMessages(folder, []string{mail("one", "old")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.selectFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+
+	// an earlier attempt has deleted the old message, but not stored the new one
+	uids, err := conn.searchHeader(idHeader, "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.delete(uids); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &replaceCommando{folder: folder, header: idHeader, value: "one", newContent: mail("one", "new"), deleting: true}
+	if err = cmd.execute(conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "one"); got != "one:1" {
+		t.Errorf("Unexpected messages: %s", got)
+	}
+}
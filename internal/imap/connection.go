@@ -1,8 +1,10 @@
 package imap
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"net/textproto"
 	"slices"
 	"strings"
 	"time"
@@ -11,9 +13,13 @@ import (
 	uidplus "github.com/emersion/go-imap-uidplus"
 	imapClient "github.com/emersion/go-imap/client"
 
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 )
 
+// noopTimeout is the time a server may take to answer a NOOP, before the connection is considered dead.
+const noopTimeout = 30 * time.Second
+
 type client struct {
 	*imapClient.Client
 	*uidplus.UidPlusClient
@@ -23,25 +29,7 @@ type connection struct {
 	*connConf
 	mailboxes *mailboxes
 	c         *client
-}
-
-func (conn *connection) startTls() error {
-	hasStartTls, err := conn.c.SupportStartTLS()
-	if err != nil {
-		return fmt.Errorf("checking for starttls for %s: %w", conn.host, err)
-	}
-
-	if hasStartTls {
-		if err = conn.c.StartTLS(nil); err != nil {
-			return fmt.Errorf("enabling starttls for %s: %w", conn.host, err)
-		}
-
-		log.Print("Connected to ", conn.host, " (STARTTLS)")
-	} else {
-		log.Print("Connected to ", conn.host, " (Plain)")
-	}
-
-	return nil
+	lastUsed  time.Time // end of the last command
 }
 
 func (conn *connection) disconnect() bool {
@@ -53,6 +41,34 @@ func (conn *connection) disconnect() bool {
 	return false
 }
 
+// healthy reports whether the connection is usable. If it has been idle for longer than the
+// given duration, the server is asked with a NOOP.
+func (conn *connection) healthy(idle time.Duration) bool {
+	select {
+	case <-conn.c.LoggedOut():
+		return false
+	default:
+	}
+
+	if time.Since(conn.lastUsed) < idle {
+		return true
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- conn.c.Noop() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Debugf("NOOP on connection to %s failed: %s", conn.host, err)
+		}
+		return err == nil
+	case <-time.After(noopTimeout):
+		log.Debugf("NOOP on connection to %s timed out", conn.host)
+		return false
+	}
+}
+
 func (conn *connection) createFolder(folder string) error {
 	err := conn.c.Create(folder)
 	if err != nil {
@@ -191,28 +207,82 @@ func (conn *connection) fetchFlags(uid uint32) ([]string, error) {
 	return flags, nil
 }
 
-func (conn *connection) replace(folder Folder, header, value, newContent string, force bool) error {
+// findLocation checks whether the message at the location still exists in the selected folder.
+func (conn *connection) findLocation(folder Folder, status *imap.MailboxStatus, loc sink.Location) ([]uint32, error) {
+	if loc.Empty() || loc.Folder != folder.str || loc.UidValidity != status.UidValidity {
+		return nil, nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddNum(loc.Uid)
+	criteria.WithoutFlags = []string{imap.DeletedFlag}
+	ids, err := conn.search(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("searching for UID %d: %w", loc.Uid, err)
+	}
+	return ids, nil
+}
+
+// messageId returns the Message-Id header of the message, or the empty string.
+func messageId(msg string) string {
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(msg))).ReadMIMEHeader()
+	if err != nil && header == nil {
+		return ""
+	}
+	return header.Get("Message-Id")
+}
+
+// findMessage searches the selected folder for the message by its Message-Id. It returns nil, if it is not found.
+func (conn *connection) findMessage(folder Folder, status *imap.MailboxStatus, msg string) (*sink.Location, error) {
+	id := messageId(msg)
+	if id == "" {
+		return nil, nil
+	}
+
+	uids, err := conn.searchHeader("Message-Id", id)
+	if err != nil || len(uids) == 0 {
+		return nil, err
+	}
+
+	log.Debugf("Message %s has already been stored in %s", id, folder)
+	return &sink.Location{Folder: folder.str, UidValidity: status.UidValidity, Uid: slices.Max(uids)}, nil
+}
+
+// replace replaces the message found at the old location, or else by its header, with the new content.
+// Before the old message is deleted, deleting is set.
+func (conn *connection) replace(folder Folder, header, value, newContent string, force bool, old sink.Location, deleting *bool) (sink.Location, error) {
 	var err error
 	var msgIds []uint32
+	var status *imap.MailboxStatus
 
-	if err = conn.selectFolder(folder); err != nil {
-		return err
+	if status, err = conn.selectFolder(folder); err != nil {
+		return sink.Location{}, err
 	}
 
-	if msgIds, err = conn.searchHeader(header, value); err != nil {
-		return err
+	if msgIds, err = conn.findLocation(folder, status, old); err != nil {
+		return sink.Location{}, err
+	}
+
+	if len(msgIds) == 0 {
+		if !old.Empty() {
+			log.Debugf("Message %s=%q is not at UID %d anymore, searching", header, value, old.Uid)
+		}
+		if msgIds, err = conn.searchHeader(header, value); err != nil {
+			return sink.Location{}, err
+		}
 	}
 
 	if len(msgIds) == 0 {
 		if force {
 			return conn.append(folder, nil, newContent)
 		}
-		return nil // nothing to do
+		return sink.Location{}, nil // nothing to do
 	}
 
 	var flags []string
 	if flags, err = conn.fetchFlags(msgIds[0]); err != nil {
-		return err
+		return sink.Location{}, err
 	}
 
 	// filter \Seen --> updating should be noted :)
@@ -223,15 +293,12 @@ func (conn *connection) replace(folder Folder, header, value, newContent string,
 		}
 	}
 
+	*deleting = true
 	if err = conn.delete(msgIds); err != nil {
-		return err
-	}
-
-	if err = conn.append(folder, filteredFlags, newContent); err != nil {
-		return err
+		return sink.Location{}, err
 	}
 
-	return nil
+	return conn.append(folder, filteredFlags, newContent)
 }
 
 func (conn *connection) searchHeader(header, value string) ([]uint32, error) {
@@ -249,33 +316,49 @@ func (conn *connection) search(criteria *imap.SearchCriteria) ([]uint32, error)
 	return conn.c.UidSearch(criteria)
 }
 
-func (conn *connection) selectFolder(folder Folder) error {
-	if _, err := conn.c.Select(folder.str, false); err != nil {
-		return fmt.Errorf("selecting folder %s: %w", folder, err)
+func (conn *connection) selectFolder(folder Folder) (*imap.MailboxStatus, error) {
+	status, err := conn.c.Select(folder.str, false)
+	if err != nil {
+		return nil, fmt.Errorf("selecting folder %s: %w", folder, err)
 	}
 
-	return nil
+	return status, nil
 }
 
-func (conn *connection) append(folder Folder, flags []string, msg string) error {
+// append uploads the message. The location is only known if the server supports UIDPLUS.
+func (conn *connection) append(folder Folder, flags []string, msg string) (sink.Location, error) {
 	reader := strings.NewReader(msg)
-	if err := conn.c.Client.Append(folder.str, flags, time.Now(), reader); err != nil {
-		return fmt.Errorf("uploading message to %s: %w", folder, err)
+	validity, uid, err := conn.c.UidPlusClient.Append(folder.str, flags, time.Now(), reader)
+	if err != nil {
+		return sink.Location{}, fmt.Errorf("uploading message to %s: %w", folder, err)
+	}
+	if uid == 0 {
+		return sink.Location{}, nil
 	}
 
-	return nil
+	return sink.Location{Folder: folder.str, UidValidity: validity, Uid: uid}, nil
 }
 
-func (conn *connection) putMessages(folder Folder, messages []string) error {
+// putMessages uploads the messages. On error, the locations of the messages stored so far are returned.
+func (conn *connection) putMessages(folder Folder, messages []string) ([]sink.Location, error) {
 	if len(messages) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	for _, msg := range messages {
-		if err := conn.append(folder, nil, msg); err != nil {
-			return err
+	if ok, _ := conn.c.Support("MULTIAPPEND"); ok && len(messages) > 1 {
+		return conn.putMessagesBatched(folder, messages)
+	}
+	return conn.putMessagesSingly(folder, messages)
+}
+
+func (conn *connection) putMessagesSingly(folder Folder, messages []string) ([]sink.Location, error) {
+	locations := make([]sink.Location, len(messages))
+	for i, msg := range messages {
+		var err error
+		if locations[i], err = conn.append(folder, nil, msg); err != nil {
+			return locations[:i], err
 		}
 	}
 
-	return nil
+	return locations, nil
 }
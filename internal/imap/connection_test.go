@@ -0,0 +1,96 @@
+package imap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	uidplus "github.com/emersion/go-imap-uidplus"
+	imapClient "github.com/emersion/go-imap/client"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+)
+
+const idHeader = "X-Feed2Imap-Item"
+
+func mail(id, body string) string {
+	return fmt.Sprintf("From: foo@example.net\r\nMessage-Id: <%s@example.net>\r\n%s: %s\r\n\r\n%s\r\n", id, idHeader, id, body)
+}
+
+func testConnection(t *testing.T) *connection {
+	t.Helper()
+	c, err := imapClient.Dial(testServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Logout() })
+	if err = c.Login("username", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	return &connection{
+		connConf:  &connConf{host: "test"},
+		mailboxes: NewMailboxes(),
+		c:         &client{c, uidplus.NewClient(c)},
+	}
+}
+
+// count returns for each id the number of messages carrying it, not marked as deleted.
+func count(t *testing.T, conn *connection, ids ...string) string {
+	t.Helper()
+	res := make([]string, len(ids))
+	for i, id := range ids {
+		uids, err := conn.searchHeader(idHeader, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[i] = fmt.Sprintf("%s:%d", id, len(uids))
+	}
+	return strings.Join(res, ",")
+}
+
+func TestReplaceByLocation(t *testing.T) {
+	conn := testConnection(t)
+	folder := Folder{str: "INBOX", delimiter: "/"}
+
+	if _, err := conn.putMessages(folder, []string{mail("one", "one"), mail("two", "two")}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := conn.selectFolder(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids, err := conn.searchHeader(idHeader, "one")
+	if err != nil || len(uids) != 1 {
+		t.Fatalf("Searching message: %v, %v", uids, err)
+	}
+	loc := sink.Location{Folder: folder.str, UidValidity: status.UidValidity, Uid: uids[0]}
+
+	// the location takes precedence: the header value does not match any message
+	// (NB: IMAP searches for substrings, hence the distinct ids)
+	if _, err = conn.replace(folder, idHeader, "unknown", mail("uno", "updated"), false, loc, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "one", "uno", "two"); got != "one:0,uno:1,two:1" {
+		t.Errorf("Unexpected messages after replacing by location: %s", got)
+	}
+
+	// the old UID is gone now: search by header
+	if _, err = conn.replace(folder, idHeader, "two", mail("dos", "updated"), false, loc, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "uno", "two", "dos"); got != "uno:1,two:0,dos:1" {
+		t.Errorf("Unexpected messages after replacing by header: %s", got)
+	}
+
+	// a location from a different UIDVALIDITY is ignored
+	uids, _ = conn.searchHeader(idHeader, "uno")
+	stale := sink.Location{Folder: folder.str, UidValidity: status.UidValidity + 1, Uid: uids[0]}
+	if _, err = conn.replace(folder, idHeader, "unknown", mail("three", "new"), false, stale, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, conn, "uno", "three"); got != "uno:1,three:0" {
+		t.Errorf("Stale location has been used: %s", got)
+	}
+}
@@ -1,12 +1,21 @@
 package imap
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+)
 
 type Folder struct {
 	str       string
 	delimiter string
 }
 
+// asFolder converts the opaque handle of the sink back into a Folder.
+func asFolder(f sink.Folder) Folder {
+	return f.(Folder)
+}
+
 func (f Folder) IsBlank() bool {
 	return f.str == ""
 }
@@ -52,6 +61,6 @@ func (cl *Client) folderName(path []string) Folder {
 	}
 }
 
-func (cl *Client) NewFolder(path []string) Folder {
+func (cl *Client) NewFolder(path []string) sink.Folder {
 	return cl.toplevel.Append(cl.folderName(path))
 }
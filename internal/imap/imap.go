@@ -10,7 +10,7 @@ import (
 func Connect(url config.Url, numConnections int) (*Client, error) {
 	var err error
 
-	client := newClient()
+	client := newClient(url)
 	client.host = url.Host
 	defer func() {
 		if err != nil {
@@ -20,7 +20,7 @@ func Connect(url config.Url, numConnections int) (*Client, error) {
 	client.startCommander()
 
 	var conn *connection // the main connection
-	if conn, err = client.connect(url); err != nil {
+	if conn, err = client.connect(); err != nil {
 		return nil, err
 	}
 
@@ -43,8 +43,8 @@ func Connect(url config.Url, numConnections int) (*Client, error) {
 	// the other connections
 	for i := 1; i < numConnections; i++ {
 		go func(id int) {
-			if _, err := client.connect(url); err != nil { // explicitly new var 'err', b/c these are now harmless
-				log.Warnf("connecting #%d: %s", id, err)
+			if _, err := client.connectRetrying(); err != nil { // explicitly new var 'err', b/c these are now harmless
+				log.Warnf("connecting #%d: %s. Continuing with fewer connections.", id, err)
 			}
 		}(i)
 	}
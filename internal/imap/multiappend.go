@@ -0,0 +1,142 @@
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	uidplus "github.com/emersion/go-imap-uidplus"
+	"github.com/emersion/go-imap/utf7"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// limits of a single MULTIAPPEND command; servers may reject overly large commands
+const (
+	maxBatchMessages = 100
+	maxBatchSize     = 16 << 20
+)
+
+// errRejected marks a command refused by the server, in contrast to connection errors.
+var errRejected = errors.New("rejected by server")
+
+// multiAppend is an APPEND command with multiple messages, as defined in RFC 3502.
+type multiAppend struct {
+	mailbox     string
+	messages    []string
+	literalPlus bool // use non-synchronizing literals (RFC 7888)
+}
+
+func (cmd *multiAppend) Command() *imap.Command {
+	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.mailbox)
+	args := []any{imap.FormatMailboxName(mailbox)}
+
+	for _, msg := range cmd.messages {
+		if cmd.literalPlus {
+			// go-imap only sends small literals as non-synchronizing ones, so write them ourselves
+			args = append(args, imap.RawString(fmt.Sprintf("{%d+}\r\n%s", len(msg), msg)))
+		} else {
+			args = append(args, strings.NewReader(msg))
+		}
+	}
+
+	return &imap.Command{
+		Name:      "APPEND",
+		Arguments: args,
+	}
+}
+
+// appendUids parses the APPENDUID response code of a MULTIAPPEND.
+// It returns nil, if the response does not carry a UID for each of the n messages.
+func appendUids(status *imap.StatusResp, n int) (validity uint32, uids []uint32) {
+	if status.Code != uidplus.CodeAppendUid || len(status.Arguments) < 2 {
+		return 0, nil
+	}
+
+	validity, err := imap.ParseNumber(status.Arguments[0])
+	if err != nil {
+		return 0, nil
+	}
+	setStr, err := imap.ParseString(status.Arguments[1])
+	if err != nil {
+		return 0, nil
+	}
+	set, err := imap.ParseSeqSet(setStr)
+	if err != nil {
+		return 0, nil
+	}
+
+	for _, seq := range set.Set {
+		for uid := seq.Start; uid <= seq.Stop && len(uids) <= n; uid++ {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) != n {
+		return 0, nil
+	}
+	return validity, uids
+}
+
+// multiAppend uploads all messages with one command. Locations are only known if the server supports UIDPLUS.
+func (conn *connection) multiAppend(folder Folder, messages []string) ([]sink.Location, error) {
+	literalPlus, _ := conn.c.Support("LITERAL+")
+	cmd := &multiAppend{folder.str, messages, literalPlus}
+
+	status, err := conn.c.Client.Execute(cmd, nil)
+	if err != nil {
+		return nil, fmt.Errorf("uploading %d messages to %s: %w", len(messages), folder, err)
+	}
+	if err = status.Err(); err != nil {
+		return nil, fmt.Errorf("uploading %d messages to %s: %w (%s)", len(messages), folder, errRejected, err)
+	}
+
+	locations := make([]sink.Location, len(messages))
+	if validity, uids := appendUids(status, len(messages)); uids != nil {
+		for i, uid := range uids {
+			locations[i] = sink.Location{Folder: folder.str, UidValidity: validity, Uid: uid}
+		}
+	}
+	return locations, nil
+}
+
+// batches splits the messages into chunks suitable for one MULTIAPPEND each.
+func batches(messages []string) [][]string {
+	var (
+		res   [][]string
+		start int
+		size  int
+	)
+	for i, msg := range messages {
+		if i > start && (i-start >= maxBatchMessages || size+len(msg) > maxBatchSize) {
+			res = append(res, messages[start:i])
+			start, size = i, 0
+		}
+		size += len(msg)
+	}
+	if start < len(messages) {
+		res = append(res, messages[start:])
+	}
+	return res
+}
+
+// putMessagesBatched uploads the messages using MULTIAPPEND. A batch rejected by the server
+// is uploaded message by message -- MULTIAPPEND is atomic, so nothing has been stored in that case.
+func (conn *connection) putMessagesBatched(folder Folder, messages []string) ([]sink.Location, error) {
+	locations := make([]sink.Location, 0, len(messages))
+	for _, batch := range batches(messages) {
+		locs, err := conn.multiAppend(folder, batch)
+		if err != nil {
+			if !errors.Is(err, errRejected) {
+				return locations, err
+			}
+			log.Warnf("%s. Falling back to single uploads.", err)
+			if locs, err = conn.putMessagesSingly(folder, batch); err != nil {
+				return append(locations, locs...), err
+			}
+		}
+		locations = append(locations, locs...)
+	}
+	return locations, nil
+}
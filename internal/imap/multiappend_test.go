@@ -0,0 +1,352 @@
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	uidplus "github.com/emersion/go-imap-uidplus"
+	imapClient "github.com/emersion/go-imap/client"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+func TestBatches(t *testing.T) {
+	big := strings.Repeat("x", maxBatchSize/2+1)
+	many := make([]string, maxBatchMessages+1)
+
+	tests := []struct {
+		name     string
+		messages []string
+		want     []int
+	}{
+		{"Empty", nil, nil},
+		{"Single", []string{"a"}, []int{1}},
+		{"Few", []string{"a", "b", "c"}, []int{3}},
+		{"Count", many, []int{maxBatchMessages, 1}},
+		{"Size", []string{big, "a", big, big}, []int{2, 1, 1}},
+		{"Oversized", []string{"a", big + big, "b"}, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, batch := range batches(tt.messages) {
+				got = append(got, len(batch))
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestAppendUids(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     imap.StatusRespCode
+		args     []any
+		n        int
+		validity uint32
+		uids     []uint32
+	}{
+		{"Range", uidplus.CodeAppendUid, []any{"7", "10:12"}, 3, 7, []uint32{10, 11, 12}},
+		{"List", uidplus.CodeAppendUid, []any{"7", "3,5:6"}, 3, 7, []uint32{3, 5, 6}},
+		{"Single", uidplus.CodeAppendUid, []any{"7", "42"}, 1, 7, []uint32{42}},
+		{"TooFew", uidplus.CodeAppendUid, []any{"7", "10:11"}, 3, 0, nil},
+		{"TooMany", uidplus.CodeAppendUid, []any{"7", "10:20"}, 3, 0, nil},
+		{"Garbage", uidplus.CodeAppendUid, []any{"7", "foo"}, 1, 0, nil},
+		{"OtherCode", "TRYCREATE", []any{"7", "1"}, 1, 0, nil},
+		{"NoCode", "", nil, 1, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &imap.StatusResp{Type: imap.StatusRespOk, Code: tt.code, Arguments: tt.args}
+			validity, uids := appendUids(status, tt.n)
+			if validity != tt.validity {
+				t.Errorf("Validity: got %d, want %d", validity, tt.validity)
+			}
+			if diff := cmp.Diff(tt.uids, uids); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+var literal = regexp.MustCompile(`\{(\d+)(\+?)}$`)
+
+// appendServer is a scripted IMAP server, which mainly understands APPEND.
+// It records the messages of each APPEND and answers them with the given response.
+// SELECT and SEARCH operate on the messages stored, with their position as UID.
+type appendServer struct {
+	caps    string
+	respond func(n int) string // response to an APPEND of n messages, without tag; empty to store and hang up
+
+	mu      sync.Mutex
+	appends [][]string
+	stored  []string
+	syncs   int // number of synchronizing literals
+}
+
+func (s *appendServer) search(line string) []string {
+	var uids []string
+	for i, msg := range s.stored {
+		if id := messageId(msg); id != "" && strings.Contains(line, id) {
+			uids = append(uids, strconv.Itoa(i+1))
+		}
+	}
+	return uids
+}
+
+func (s *appendServer) serve(conn net.Conn, preauth bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if preauth {
+		fmt.Fprintf(conn, "* PREAUTH [CAPABILITY %s] ready\r\n", s.caps)
+	} else {
+		fmt.Fprintf(conn, "* OK [CAPABILITY %s] ready\r\n", s.caps)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		tag, cmd, _ := strings.Cut(line, " ")
+
+		var messages []string
+		for m := literal.FindStringSubmatch(line); m != nil; m = literal.FindStringSubmatch(line) {
+			if m[2] == "" {
+				s.mu.Lock()
+				s.syncs++
+				s.mu.Unlock()
+				fmt.Fprint(conn, "+ go ahead\r\n")
+			}
+			n, _ := strconv.Atoi(m[1])
+			msg := make([]byte, n)
+			if _, err = io.ReadFull(r, msg); err != nil {
+				return
+			}
+			messages = append(messages, string(msg))
+			if line, err = r.ReadString('\n'); err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+		}
+
+		s.mu.Lock()
+		switch cmd = strings.ToUpper(cmd); {
+		case strings.HasPrefix(cmd, "APPEND "):
+			s.appends = append(s.appends, messages)
+			resp := s.respond(len(messages))
+			if resp == "" || strings.HasPrefix(resp, "OK") {
+				s.stored = append(s.stored, messages...)
+			}
+			if resp == "" {
+				s.mu.Unlock()
+				return
+			}
+			fmt.Fprintf(conn, "%s %s\r\n", tag, resp)
+		case strings.HasPrefix(cmd, "LOGIN "), cmd == "NOOP":
+			fmt.Fprintf(conn, "%s OK done\r\n", tag)
+		case cmd == "CAPABILITY":
+			fmt.Fprintf(conn, "* CAPABILITY %s\r\n%s OK done\r\n", s.caps, tag)
+		case strings.HasPrefix(cmd, "LIST "):
+			fmt.Fprintf(conn, "* LIST () \"/\" \"\"\r\n%s OK done\r\n", tag)
+		case strings.HasPrefix(cmd, "SELECT "):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n* OK [UIDVALIDITY 7] ok\r\n%s OK [READ-WRITE] done\r\n", len(s.stored), tag)
+		case strings.HasPrefix(cmd, "UID SEARCH "):
+			fmt.Fprintf(conn, "* SEARCH %s\r\n%s OK done\r\n", strings.Join(s.search(line), " "), tag)
+		case cmd == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK done\r\n", tag)
+			s.mu.Unlock()
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// listen serves the server on a TCP port, returning its URL.
+func (s *appendServer) listen(t *testing.T) config.Url {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, false)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return config.Url{Scheme: "imap", Host: host, Port: port, User: "username", Password: "password"}
+}
+
+func (s *appendServer) connection(t *testing.T) *connection {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.serve(serverConn, true)
+		close(done)
+	}()
+
+	c, err := imapClient.New(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Logout()
+		<-done
+	})
+
+	return &connection{
+		connConf:  &connConf{host: "test"},
+		mailboxes: NewMailboxes(),
+		c:         &client{c, uidplus.NewClient(c)},
+	}
+}
+
+func TestPutMessages(t *testing.T) {
+	messages := []string{mail("one", "1"), mail("two", "2"), mail("three", "3")}
+	loc := func(uid uint32) sink.Location {
+		return sink.Location{Folder: "INBOX", UidValidity: 7, Uid: uid}
+	}
+	var uid uint32
+	singleUid := func(n int) string {
+		if n != 1 {
+			return "NO [TOOBIG] only one message please"
+		}
+		uid++
+		return fmt.Sprintf("OK [APPENDUID 7 %d] done", uid)
+	}
+
+	tests := []struct {
+		name      string
+		caps      string
+		respond   func(n int) string
+		appends   []int
+		syncs     int
+		locations []sink.Location
+	}{
+		{"LiteralPlus", "IMAP4rev1 MULTIAPPEND LITERAL+ UIDPLUS",
+			func(int) string { return "OK [APPENDUID 7 10:12] done" },
+			[]int{3}, 0, []sink.Location{loc(10), loc(11), loc(12)}},
+		{"SyncLiterals", "IMAP4rev1 MULTIAPPEND",
+			func(int) string { return "OK done" },
+			[]int{3}, 3, make([]sink.Location, 3)},
+		{"NoMultiAppend", "IMAP4rev1 UIDPLUS", singleUid,
+			[]int{1, 1, 1}, 3, []sink.Location{loc(1), loc(2), loc(3)}},
+		{"Rejected", "IMAP4rev1 MULTIAPPEND LITERAL+ UIDPLUS", singleUid,
+			[]int{3, 1, 1, 1}, 0, []sink.Location{loc(1), loc(2), loc(3)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid = 0
+			srv := &appendServer{caps: tt.caps, respond: tt.respond}
+			conn := srv.connection(t)
+
+			locations, err := conn.putMessages(Folder{str: "INBOX", delimiter: "/"}, messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.locations, locations); diff != "" {
+				t.Error(diff)
+			}
+
+			var appends []int
+			for _, msgs := range srv.appends {
+				appends = append(appends, len(msgs))
+			}
+			if diff := cmp.Diff(messages[:appends[0]], srv.appends[0]); diff != "" {
+				t.Errorf("Unexpected message content: %s", diff)
+			}
+			if diff := cmp.Diff(tt.appends, appends); diff != "" {
+				t.Errorf("Unexpected APPENDs (number of messages): %s", diff)
+			}
+			if srv.syncs != tt.syncs {
+				t.Errorf("Synchronizing literals: got %d, want %d", srv.syncs, tt.syncs)
+			}
+		})
+	}
+}
+
+func TestPutMessages_Interrupted(t *testing.T) {
+	messages := []string{mail("one", "1"), mail("two", "2"), mail("three", "3")}
+	loc := func(uid uint32) sink.Location {
+		return sink.Location{Folder: "INBOX", UidValidity: 7, Uid: uid}
+	}
+
+	// without UIDPLUS, only the locations of the messages found after the reconnect are known
+	tests := []struct {
+		name      string
+		caps      string
+		breakAt   int // number of the APPEND, after which the connection breaks
+		appends   []int
+		locations []sink.Location
+	}{
+		{"Batch", "IMAP4rev1 MULTIAPPEND LITERAL+", 1, []int{3}, []sink.Location{loc(1), loc(2), loc(3)}},
+		{"Single", "IMAP4rev1 LITERAL+", 2, []int{1, 1, 1}, []sink.Location{{}, loc(2), {}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldDelay := retryDelay
+			retryDelay = time.Millisecond
+			defer func() { retryDelay = oldDelay }()
+
+			count := 0
+			srv := &appendServer{caps: tt.caps, respond: func(int) string {
+				if count++; count == tt.breakAt {
+					return ""
+				}
+				return "OK done"
+			}}
+
+			cl, err := Connect(srv.listen(t), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Disconnect()
+
+			got, err := cl.PutMessages(Folder{str: "INBOX", delimiter: "/"}, messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if diff := cmp.Diff(messages, srv.stored); diff != "" {
+				t.Errorf("Unexpected messages stored: %s", diff)
+			}
+			var appends []int
+			for _, msgs := range srv.appends {
+				appends = append(appends, len(msgs))
+			}
+			if diff := cmp.Diff(tt.appends, appends); diff != "" {
+				t.Errorf("Unexpected APPENDs (number of messages): %s", diff)
+			}
+			if diff := cmp.Diff(tt.locations, got); diff != "" {
+				t.Errorf("Unexpected locations: %s", diff)
+			}
+		})
+	}
+}
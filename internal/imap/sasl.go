@@ -0,0 +1,147 @@
+package imap
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+)
+
+// xoauth2Client implements the XOAUTH2 mechanism used by Google and Microsoft.
+type xoauth2Client struct {
+	username, token string
+}
+
+func (c *xoauth2Client) Start() (string, []byte, error) {
+	return "XOAUTH2", []byte("user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01"), nil
+}
+
+func (c *xoauth2Client) Next(_ []byte) ([]byte, error) {
+	// the challenge carries the error details; answering with an empty response lets the server fail the command
+	return []byte{}, nil
+}
+
+// scramClient implements SCRAM (RFC 5802) without channel binding.
+type scramClient struct {
+	name     string
+	hash     func() hash.Hash
+	username string
+	password string
+
+	nonce       string // client nonce
+	firstBare   string // client-first-message-bare
+	serverSig   []byte
+	step        int
+	clientNonce func() string // for tests
+}
+
+func newScramClient(name string, hash func() hash.Hash, username, password string) *scramClient {
+	return &scramClient{name: name, hash: hash, username: username, password: password}
+}
+
+func newScramSha1Client(username, password string) sasl.Client {
+	return newScramClient("SCRAM-SHA-1", sha1.New, username, password)
+}
+
+func newScramSha256Client(username, password string) sasl.Client {
+	return newScramClient("SCRAM-SHA-256", sha256.New, username, password)
+}
+
+func scramEscape(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+func (c *scramClient) Start() (string, []byte, error) {
+	if c.clientNonce != nil {
+		c.nonce = c.clientNonce()
+	} else {
+		c.nonce = rand.Text()
+	}
+	c.firstBare = "n=" + scramEscape(c.username) + ",r=" + c.nonce
+	c.step = 1
+	return c.name, []byte("n,," + c.firstBare), nil
+}
+
+func (c *scramClient) hmac(key []byte, data string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (c *scramClient) sum(data []byte) []byte {
+	h := c.hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func scramAttributes(msg []byte) map[byte]string {
+	attrs := make(map[byte]string)
+	for attr := range strings.SplitSeq(string(msg), ",") {
+		if len(attr) >= 2 && attr[1] == '=' {
+			attrs[attr[0]] = attr[2:]
+		}
+	}
+	return attrs
+}
+
+func (c *scramClient) Next(challenge []byte) ([]byte, error) {
+	attrs := scramAttributes(challenge)
+	if e, ok := attrs['e']; ok {
+		return nil, fmt.Errorf("%s: server error '%s'", c.name, e)
+	}
+
+	switch c.step {
+	case 1: // server-first-message
+		c.step++
+		nonce, salt64, iterStr := attrs['r'], attrs['s'], attrs['i']
+		if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+			return nil, fmt.Errorf("%s: invalid nonce from server", c.name)
+		}
+		salt, err := base64.StdEncoding.DecodeString(salt64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid salt from server: %w", c.name, err)
+		}
+		iter, err := strconv.Atoi(iterStr)
+		if err != nil || iter <= 0 {
+			return nil, fmt.Errorf("%s: invalid iteration count '%s' from server", c.name, iterStr)
+		}
+
+		salted, err := pbkdf2.Key(c.hash, c.password, salt, iter, c.hash().Size())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+
+		finalBare := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + nonce
+		authMsg := c.firstBare + "," + string(challenge) + "," + finalBare
+
+		clientKey := c.hmac(salted, "Client Key")
+		clientSig := c.hmac(c.sum(clientKey), authMsg)
+		proof := make([]byte, len(clientKey))
+		subtle.XORBytes(proof, clientKey, clientSig)
+
+		c.serverSig = c.hmac(c.hmac(salted, "Server Key"), authMsg)
+
+		return []byte(finalBare + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+
+	case 2: // server-final-message
+		c.step++
+		sig, err := base64.StdEncoding.DecodeString(attrs['v'])
+		if err != nil || !hmac.Equal(sig, c.serverSig) {
+			return nil, fmt.Errorf("%s: server signature does not match", c.name)
+		}
+		return []byte{}, nil
+
+	default:
+		return nil, errors.New(c.name + ": unexpected challenge")
+	}
+}
@@ -0,0 +1,71 @@
+package imap
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestScramClient(t *testing.T) {
+	// test vectors of RFC 5802 and RFC 7677
+	tests := []struct {
+		name               string
+		hash               func() hash.Hash
+		nonce              string
+		first, serverFirst string
+		final, serverFinal string
+	}{
+		{"SCRAM-SHA-1", sha1.New, "fyko+d2lbbFgONRv9qkxdawL",
+			"n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+			"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			"v=rmF9pqV8S7suAoZWja4dJRkFsKQ="},
+		{"SCRAM-SHA-256", sha256.New, "rOprNGfwEbeRWgbNEkqO",
+			"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newScramClient(tt.name, tt.hash, "user", "pencil")
+			c.clientNonce = func() string { return tt.nonce }
+
+			mech, first, err := c.Start()
+			if err != nil || mech != tt.name || string(first) != tt.first {
+				t.Fatalf("Start() = %s, %s, %v", mech, first, err)
+			}
+
+			final, err := c.Next([]byte(tt.serverFirst))
+			if err != nil || string(final) != tt.final {
+				t.Fatalf("Next() = %s, %v; want %s", final, err, tt.final)
+			}
+
+			if _, err = c.Next([]byte(tt.serverFinal)); err != nil {
+				t.Errorf("Verifying server signature: %v", err)
+			}
+		})
+	}
+}
+
+func TestScramClient_BadServer(t *testing.T) {
+	c := newScramClient("SCRAM-SHA-256", sha256.New, "user", "pencil")
+	c.clientNonce = func() string { return "abc" }
+	_, _, _ = c.Start()
+
+	if _, err := c.Next([]byte("r=xyz,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")); err == nil {
+		t.Error("Foreign nonce not detected")
+	}
+
+	c = newScramClient("SCRAM-SHA-256", sha256.New, "user", "pencil")
+	c.clientNonce = func() string { return "abc" }
+	_, _, _ = c.Start()
+	if _, err := c.Next([]byte("r=abcdef,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err == nil {
+		t.Error("Wrong server signature not detected")
+	}
+}
@@ -0,0 +1,68 @@
+package maildir
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+// Maildir++ uses '.' to separate the levels of the hierarchy
+const ppDelimiter = "."
+
+type Folder struct {
+	str  string
+	path string
+}
+
+// asFolder converts the opaque handle of the sink back into a Folder.
+func asFolder(f sink.Folder) Folder {
+	return f.(Folder)
+}
+
+func (f Folder) IsBlank() bool {
+	return f.str == ""
+}
+
+func (f Folder) String() string {
+	return f.str
+}
+
+func splitPath(path []string) []string {
+	parts := make([]string, 0, len(path))
+	for _, p := range path {
+		for _, elem := range strings.Split(p, "/") {
+			if elem = strings.TrimSpace(elem); elem != "" {
+				parts = append(parts, elem)
+			}
+		}
+	}
+	return parts
+}
+
+func (cl *Client) NewFolder(path []string) sink.Folder {
+	return cl.newFolder(path)
+}
+
+func (cl *Client) newFolder(path []string) Folder {
+	parts := splitPath(path)
+
+	switch cl.layout {
+	case config.LayoutNested:
+		name := filepath.Join(parts...)
+		return Folder{
+			str:  name,
+			path: filepath.Join(cl.root, name),
+		}
+	default: // Maildir++
+		name := strings.Join(parts, ppDelimiter)
+		if name == "" {
+			return Folder{"", cl.root}
+		}
+		return Folder{
+			str:  name,
+			path: filepath.Join(cl.root, ppDelimiter+name),
+		}
+	}
+}
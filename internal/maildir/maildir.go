@@ -0,0 +1,259 @@
+package maildir
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+const (
+	dirTmp = "tmp"
+	dirNew = "new"
+	dirCur = "cur"
+
+	// separates the unique name from the flags of a message in 'cur'
+	infoSeparator = ":2,"
+
+	flagSeen    = 'S'
+	flagTrashed = 'T'
+)
+
+var subDirs = []string{dirTmp, dirNew, dirCur}
+
+var _ sink.Sink = (*Client)(nil)
+
+type Client struct {
+	root     string
+	layout   string
+	hostname string
+	counter  atomic.Uint64
+	mu       sync.Mutex
+	folders  map[string]struct{}
+}
+
+// Open prepares the maildir hierarchy given by url for delivery.
+func Open(url config.Url) (*Client, error) {
+	client := &Client{
+		root:     url.Root,
+		layout:   url.Layout,
+		hostname: sanitizeHostname(config.Hostname()),
+		folders:  map[string]struct{}{},
+	}
+
+	log.Printf("Using maildir '%s' (layout: %s)", client.root, client.layout)
+
+	if client.layout == config.LayoutMaildirPP {
+		// in Maildir++ the root is the INBOX and needs to be a maildir on its own
+		if err := client.ensureFolder(client.newFolder(nil)); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// Disconnect exists to mirror the IMAP client. There is nothing to be done for a maildir.
+func (cl *Client) Disconnect() {}
+
+func sanitizeHostname(hostname string) string {
+	// '/' and ':' are not allowed in the hostname part of a maildir name
+	return strings.NewReplacer("/", `\057`, ":", `\072`).Replace(hostname)
+}
+
+func (cl *Client) uniqueName() string {
+	now := time.Now()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s",
+		now.Unix(), now.Nanosecond()/1000, os.Getpid(), cl.counter.Add(1), cl.hostname)
+}
+
+func (cl *Client) EnsureFolder(folder sink.Folder) error {
+	return cl.ensureFolder(asFolder(folder))
+}
+
+func (cl *Client) ensureFolder(folder Folder) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if _, ok := cl.folders[folder.path]; ok {
+		return nil
+	}
+
+	created := false
+	for _, sub := range subDirs {
+		dir := filepath.Join(folder.path, sub)
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("checking folder '%s': %w", folder.path, err)
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("creating folder '%s': %w", folder.path, err)
+		}
+		created = true
+	}
+
+	if created {
+		log.Printf("Created folder '%s'", folder.path)
+	}
+
+	cl.folders[folder.path] = struct{}{}
+	return nil
+}
+
+// toLF converts the CRLF line endings of a mail into the LF endings used for files in a maildir.
+func toLF(msg string) string {
+	return strings.ReplaceAll(msg, "\r\n", "\n")
+}
+
+func (cl *Client) deliver(folder Folder, flags string, msg string) error {
+	name := cl.uniqueName()
+	tmpFile := filepath.Join(folder.path, dirTmp, name)
+
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("creating message in %s: %w", folder.path, err)
+	}
+
+	if _, err = f.WriteString(toLF(msg)); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("writing message to %s: %w", tmpFile, err)
+	}
+
+	var target string
+	if flags == "" {
+		target = filepath.Join(folder.path, dirNew, name)
+	} else {
+		target = filepath.Join(folder.path, dirCur, name+infoSeparator+flags)
+	}
+
+	if err = os.Rename(tmpFile, target); err != nil {
+		_ = os.Remove(tmpFile)
+		return fmt.Errorf("moving message to %s: %w", target, err)
+	}
+
+	return nil
+}
+
+func (cl *Client) PutMessages(sinkFolder sink.Folder, messages []string) ([]sink.Location, error) {
+	folder := asFolder(sinkFolder)
+	for _, msg := range messages {
+		if err := cl.deliver(folder, "", msg); err != nil {
+			return nil, err
+		}
+	}
+
+	// messages in a maildir are found by searching, their names are not stable anyway
+	return make([]sink.Location, len(messages)), nil
+}
+
+// flags returns the flags encoded in the name of a maildir message.
+func flags(name string) string {
+	if _, flags, found := strings.Cut(name, infoSeparator); found {
+		return flags
+	}
+	return ""
+}
+
+func headerMatches(file, header, value string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	h, err := textproto.NewReader(bufio.NewReader(f)).ReadMIMEHeader()
+	if err != nil && len(h) == 0 {
+		return false, err
+	}
+
+	return slices.Contains(h.Values(header), value), nil
+}
+
+// search returns the files in folder that carry the given header value.
+// Messages marked as trashed are ignored.
+func (cl *Client) search(folder Folder, header, value string) ([]string, error) {
+	var matches []string
+
+	for _, sub := range []string{dirNew, dirCur} {
+		dir := filepath.Join(folder.path, sub)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading folder %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.ContainsRune(flags(entry.Name()), flagTrashed) {
+				continue
+			}
+
+			file := filepath.Join(dir, entry.Name())
+			ok, err := headerMatches(file, header, value)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					// moved by someone else in the meantime
+					continue
+				}
+				return nil, fmt.Errorf("reading message %s: %w", file, err)
+			}
+			if ok {
+				matches = append(matches, file)
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+func (cl *Client) Replace(sinkFolder sink.Folder, header, value, newContent string, force bool, _ sink.Location) (sink.Location, error) {
+	return sink.Location{}, cl.replace(asFolder(sinkFolder), header, value, newContent, force)
+}
+
+func (cl *Client) replace(folder Folder, header, value, newContent string, force bool) error {
+	files, err := cl.search(folder, header, value)
+	if err != nil {
+		return fmt.Errorf("searching for header %q=%q: %w", header, value, err)
+	}
+
+	if len(files) == 0 {
+		if force {
+			return cl.deliver(folder, "", newContent)
+		}
+		return nil // nothing to do
+	}
+
+	// filter 'seen' --> updating should be noted :)
+	newFlags := strings.Map(func(r rune) rune {
+		if r == flagSeen {
+			return -1
+		}
+		return r
+	}, flags(filepath.Base(files[0])))
+
+	for _, file := range files {
+		if err = os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("deleting message %s: %w", file, err)
+		}
+	}
+
+	return cl.deliver(folder, newFlags, newContent)
+}
@@ -0,0 +1,157 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+)
+
+const idHeader = "X-Feed2Imap-Item"
+
+func mail(id, body string) string {
+	return "From: foo@example.net\r\n" + idHeader + ": " + id + "\r\n\r\n" + body + "\r\n"
+}
+
+func open(t *testing.T, layout string) *Client {
+	t.Helper()
+	cl, err := Open(config.Url{Scheme: "maildir", Root: t.TempDir(), Layout: layout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl
+}
+
+func files(t *testing.T, folder Folder, sub string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(folder.path, sub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestNewFolder(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		path   []string
+		str    string
+		rel    string
+	}{
+		{"Maildir++ Root", config.LayoutMaildirPP, nil, "", ""},
+		{"Maildir++ Simple", config.LayoutMaildirPP, []string{"Feeds"}, "Feeds", ".Feeds"},
+		{"Maildir++ Nested", config.LayoutMaildirPP, []string{"Feeds", "Linux/Arch"}, "Feeds.Linux.Arch", ".Feeds.Linux.Arch"},
+		{"Nested Root", config.LayoutNested, nil, "", ""},
+		{"Nested", config.LayoutNested, []string{"Feeds", "Linux/Arch"}, "Feeds/Linux/Arch", "Feeds/Linux/Arch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &Client{root: "/mail", layout: tt.layout}
+			f := cl.newFolder(tt.path)
+
+			if diff := cmp.Diff(tt.str, f.String()); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(filepath.Join("/mail", tt.rel), f.path); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestPutMessages(t *testing.T) {
+	cl := open(t, config.LayoutMaildirPP)
+	folder := cl.newFolder([]string{"Feeds"})
+
+	if err := cl.EnsureFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cl.PutMessages(folder, []string{mail("1", "one"), mail("2", "two")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(files(t, folder, dirNew)); n != 2 {
+		t.Errorf("Expected 2 messages in 'new', got %d", n)
+	}
+	if n := len(files(t, folder, dirTmp)); n != 0 {
+		t.Errorf("Expected no messages in 'tmp', got %d", n)
+	}
+
+	content, err := os.ReadFile(filepath.Join(folder.path, dirNew, files(t, folder, dirNew)[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "\r") {
+		t.Error("Message still contains CRLF line endings")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	cl := open(t, config.LayoutNested)
+	folder := cl.newFolder([]string{"Feeds"})
+
+	if err := cl.EnsureFolder(folder); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cl.PutMessages(folder, []string{mail("1", "one"), mail("2", "two")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a mail client, which has read and flagged the first message
+	var old string
+	for _, name := range files(t, folder, dirNew) {
+		if ok, _ := headerMatches(filepath.Join(folder.path, dirNew, name), idHeader, "1"); ok {
+			old = name
+		}
+	}
+	if err := os.Rename(filepath.Join(folder.path, dirNew, old), filepath.Join(folder.path, dirCur, old+":2,FS")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cl.Replace(folder, idHeader, "1", mail("1", "updated"), false, sink.Location{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cur := files(t, folder, dirCur)
+	if len(cur) != 1 || flags(cur[0]) != "F" || strings.HasPrefix(cur[0], old) {
+		t.Errorf("Expected one new message with flag 'F' in 'cur', got %v", cur)
+	}
+	if n := len(files(t, folder, dirNew)); n != 1 {
+		t.Errorf("Expected 1 message in 'new', got %d", n)
+	}
+
+	content, err := os.ReadFile(filepath.Join(folder.path, dirCur, cur[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "updated") {
+		t.Error("Message has not been updated")
+	}
+
+	// unknown id: only uploaded when forced
+	if _, err := cl.Replace(folder, idHeader, "3", mail("3", "three"), false, sink.Location{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(files(t, folder, dirNew)); n != 1 {
+		t.Errorf("Expected 1 message in 'new', got %d", n)
+	}
+	if _, err := cl.Replace(folder, idHeader, "3", mail("3", "three"), true, sink.Location{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(files(t, folder, dirNew)); n != 2 {
+		t.Errorf("Expected 2 messages in 'new', got %d", n)
+	}
+}
@@ -3,7 +3,7 @@ package msg
 import (
 	"fmt"
 
-	"github.com/Necoro/feed2imap-go/internal/imap"
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 )
 
@@ -22,42 +22,52 @@ type Message struct {
 	Content  string
 	IsUpdate bool
 	ID       string
+	Location sink.Location // where the message has been stored before; updated by Upload
 }
 
-func (m Messages) Upload(client *imap.Client, folder imap.Folder, reupload bool) error {
+// Upload stores the messages into the folder and records their new locations.
+func (m Messages) Upload(client sink.Sink, folder sink.Folder, reupload bool) error {
 	toStore := make([]string, 0, len(m))
+	storeIdx := make([]int, 0, len(m))
 
-	updateMsgs := make(chan Message, 5)
+	updateMsgs := make(chan *Message, 5)
 	ok := make(chan bool)
 	go func() { /* update goroutine */
 		errHappened := false
 		for msg := range updateMsgs {
-			if err := client.Replace(folder, IdHeader, msg.ID, msg.Content, reupload); err != nil {
+			loc, err := client.Replace(folder, IdHeader, msg.ID, msg.Content, reupload, msg.Location)
+			if err != nil {
 				log.Errorf("Error while updating mail with id '%s' in folder '%s'. Skipping.: %s",
 					msg.ID, folder, err)
 				errHappened = true
+				continue
 			}
+			msg.Location = loc
 		}
 
 		ok <- errHappened
 	}()
 
-	for _, msg := range m {
-		if !msg.IsUpdate {
-			toStore = append(toStore, msg.Content)
+	for i := range m {
+		if !m[i].IsUpdate {
+			toStore = append(toStore, m[i].Content)
+			storeIdx = append(storeIdx, i)
 		} else {
-			updateMsgs <- msg
+			updateMsgs <- &m[i]
 		}
 	}
 
 	close(updateMsgs)
 
-	putErr := client.PutMessages(folder, toStore)
+	locations, putErr := client.PutMessages(folder, toStore)
 	updOk := <-ok
 
 	if putErr != nil {
 		return putErr
 	}
+	for i, loc := range locations {
+		m[storeIdx[i]].Location = loc
+	}
 	if updOk {
 		return fmt.Errorf("Errors during updating mails.")
 	}
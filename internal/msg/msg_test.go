@@ -0,0 +1,69 @@
+package msg
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/Necoro/feed2imap-go/internal/sink"
+)
+
+// fakeSink hands out increasing UIDs.
+type fakeSink struct {
+	mu       sync.Mutex
+	uid      uint32
+	replaced map[string]sink.Location
+}
+
+func (s *fakeSink) next() sink.Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uid++
+	return sink.Location{Folder: "INBOX", UidValidity: 1, Uid: s.uid}
+}
+
+func (s *fakeSink) NewFolder(path []string) sink.Folder { return sink.DryRun().NewFolder(path) }
+func (s *fakeSink) EnsureFolder(sink.Folder) error      { return nil }
+func (s *fakeSink) Disconnect()                         {}
+
+func (s *fakeSink) PutMessages(_ sink.Folder, messages []string) ([]sink.Location, error) {
+	locs := make([]sink.Location, len(messages))
+	for i := range messages {
+		locs[i] = s.next()
+	}
+	return locs, nil
+}
+
+func (s *fakeSink) Replace(_ sink.Folder, _, value, _ string, _ bool, old sink.Location) (sink.Location, error) {
+	s.mu.Lock()
+	s.replaced[value] = old
+	s.mu.Unlock()
+	return s.next(), nil
+}
+
+func TestUploadLocations(t *testing.T) {
+	s := &fakeSink{uid: 10, replaced: map[string]sink.Location{}}
+	old := sink.Location{Folder: "INBOX", UidValidity: 1, Uid: 3}
+	msgs := Messages{
+		{Content: "a", ID: "a"},
+		{Content: "b", ID: "b", IsUpdate: true, Location: old},
+		{Content: "c", ID: "c"},
+	}
+
+	if err := msgs.Upload(s, s.NewFolder(nil), false); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(map[string]sink.Location{"b": old}, s.replaced); diff != "" {
+		t.Errorf("Replace got wrong old locations: %s", diff)
+	}
+
+	seen := map[uint32]bool{}
+	for _, m := range msgs {
+		if m.Location.Uid <= 10 || seen[m.Location.Uid] {
+			t.Errorf("Message %s: unexpected location %v", m.ID, m.Location)
+		}
+		seen[m.Location.Uid] = true
+	}
+}
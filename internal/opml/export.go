@@ -0,0 +1,68 @@
+package opml
+
+import (
+	"slices"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// Export creates an OPML document from the feeds of the configuration.
+// The targets of the feeds are represented as nested folder outlines.
+// Feeds without URL (i.e., using `exec`) cannot be represented and are skipped.
+func Export(cfg *config.Config) *Document {
+	doc := &Document{
+		Version: version,
+		Title:   "feed2imap-go",
+	}
+
+	names := make([]string, 0, len(cfg.Feeds))
+	for name := range cfg.Feeds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		feed := cfg.Feeds[name]
+		if feed.Url == "" {
+			log.Warnf("Feed '%s' has no URL and cannot be exported to OPML. Skipping.", name)
+			continue
+		}
+
+		outline := Outline{
+			Text:   feed.Name,
+			Title:  feed.Name,
+			Type:   "rss",
+			XmlUrl: feed.Url,
+		}
+
+		// In the common case, the target of a feed is its name inside the folders of its groups.
+		// Otherwise, all the target forms the folders, and the feed itself does not add anything.
+		folders := feed.Target
+		if n := len(folders); n > 0 && folders[n-1] == feed.Name {
+			folders = folders[:n-1]
+		} else {
+			outline.Target = new(string)
+		}
+
+		body := &doc.Body
+		for _, folder := range folders {
+			body = &findFolder(body, folder).Outline
+		}
+		*body = append(*body, outline)
+	}
+
+	return doc
+}
+
+// findFolder returns the folder outline of the given name, creating it if necessary.
+func findFolder(outlines *[]Outline, name string) *Outline {
+	for i := range *outlines {
+		if o := &(*outlines)[i]; !o.IsFeed() && o.Text == name {
+			return o
+		}
+	}
+
+	*outlines = append(*outlines, Outline{Text: name, Title: name})
+	return &(*outlines)[len(*outlines)-1]
+}
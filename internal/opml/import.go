@@ -0,0 +1,119 @@
+package opml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// entry is a feed or group of the configuration, as written in YAML.
+type entry struct {
+	Name   string  `yaml:"name,omitempty"`
+	Group  string  `yaml:"group,omitempty"`
+	Url    string  `yaml:"url,omitempty"`
+	Target *string `yaml:"target,omitempty"`
+	Feeds  []entry `yaml:"feeds,omitempty"`
+}
+
+type importer struct {
+	urls    map[string]struct{} // URLs of known feeds
+	names   map[string]struct{} // names of known feeds
+	added   int
+	skipped int
+}
+
+// Import converts the outlines of the OPML document into the `feeds` section of a configuration.
+// Folders become groups, with their name as target. Feeds, whose URL is already part of existing,
+// are skipped. Returns the number of imported feeds.
+func Import(doc *Document, existing config.Feeds, out io.Writer) (int, error) {
+	imp := importer{
+		urls:  make(map[string]struct{}, len(existing)),
+		names: make(map[string]struct{}, len(existing)),
+	}
+	for name, feed := range existing {
+		imp.names[name] = struct{}{}
+		if feed.Url != "" {
+			imp.urls[feed.Url] = struct{}{}
+		}
+	}
+
+	entries := imp.convert(doc.Body)
+	if imp.skipped > 0 {
+		log.Printf("Skipped %d feeds that are already configured.", imp.skipped)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string][]entry{"feeds": entries}); err != nil {
+		return 0, fmt.Errorf("writing YAML: %w", err)
+	}
+	return imp.added, enc.Close()
+}
+
+func (imp *importer) convert(outlines []Outline) []entry {
+	var entries []entry
+
+	for _, o := range outlines {
+		name := strings.TrimSpace(o.Name())
+
+		if !o.IsFeed() {
+			feeds := imp.convert(o.Outline)
+			if len(feeds) == 0 {
+				continue
+			}
+			if name == "" {
+				// unnamed folders do not add a level
+				entries = append(entries, feeds...)
+				continue
+			}
+			entries = append(entries, entry{Group: name, Target: &name, Feeds: feeds})
+			continue
+		}
+
+		url := strings.TrimSpace(o.XmlUrl)
+		if _, ok := imp.urls[url]; ok {
+			log.Printf("Feed '%s' (%s) is already configured. Skipping.", name, url)
+			imp.skipped++
+			continue
+		}
+		imp.urls[url] = struct{}{}
+
+		e := entry{Name: imp.uniqueName(name, url), Url: url, Target: o.Target}
+		if e.Target == nil {
+			e.Target = &e.Name
+		}
+		entries = append(entries, e)
+		imp.added++
+	}
+
+	return entries
+}
+
+// uniqueName returns a name for the feed, that has not been used yet.
+func (imp *importer) uniqueName(name, url string) string {
+	if name == "" {
+		name = url
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := imp.names[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+
+	if unique != name {
+		log.Warnf("Feed name '%s' is already taken. Using '%s' instead.", name, unique)
+	}
+	imp.names[unique] = struct{}{}
+	return unique
+}
@@ -0,0 +1,63 @@
+// Package opml converts between the feeds of a configuration and OPML outlines.
+package opml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const version = "2.0"
+
+type Document struct {
+	XMLName xml.Name  `xml:"opml"`
+	Version string    `xml:"version,attr"`
+	Title   string    `xml:"head>title,omitempty"`
+	Body    []Outline `xml:"body>outline"`
+}
+
+type Outline struct {
+	Text    string    `xml:"text,attr"`
+	Title   string    `xml:"title,attr,omitempty"`
+	Type    string    `xml:"type,attr,omitempty"`
+	XmlUrl  string    `xml:"xmlUrl,attr,omitempty"`
+	HtmlUrl string    `xml:"htmlUrl,attr,omitempty"`
+	Target  *string   `xml:"target,attr"` // non-standard: target of a feed that differs from its name
+	Outline []Outline `xml:"outline"`
+}
+
+// IsFeed returns whether the outline denotes a feed (as opposed to a folder).
+func (o *Outline) IsFeed() bool {
+	return o.XmlUrl != ""
+}
+
+// Name returns the name of the outline, preferring the text over the title.
+func (o *Outline) Name() string {
+	if o.Text != "" {
+		return o.Text
+	}
+	return o.Title
+}
+
+func Read(in io.Reader) (*Document, error) {
+	var doc Document
+	if err := xml.NewDecoder(in).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("reading OPML: %w", err)
+	}
+	return &doc, nil
+}
+
+func (doc *Document) Write(out io.Writer) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("writing OPML: %w", err)
+	}
+
+	_, err := io.WriteString(out, "\n")
+	return err
+}
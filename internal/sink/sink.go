@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// Folder is an opaque handle to a folder inside a Sink.
+// It must only be passed to the Sink that created it.
+type Folder interface {
+	fmt.Stringer
+}
+
+// Location identifies a stored message, if the sink supports it: for IMAP with UIDPLUS,
+// these are folder, UIDVALIDITY, and UID. The zero value denotes an unknown location.
+type Location struct {
+	Folder      string
+	UidValidity uint32
+	Uid         uint32
+}
+
+func (l Location) Empty() bool {
+	return l.Uid == 0
+}
+
+// Sink is the destination of the messages created from the feeds.
+type Sink interface {
+	// NewFolder creates the handle for the folder denoted by path.
+	NewFolder(path []string) Folder
+	// EnsureFolder creates the folder, if it does not exist yet.
+	EnsureFolder(folder Folder) error
+	// PutMessages stores new messages into the folder. It returns the locations of the stored messages, in order.
+	PutMessages(folder Folder, messages []string) ([]Location, error)
+	// Replace exchanges the message carrying the header with the given value by newContent.
+	// If the old location is known, it is tried first to find the message.
+	// If no such message exists, newContent is only stored when force is set.
+	// It returns the location of the new message.
+	Replace(folder Folder, header, value, newContent string, force bool, old Location) (Location, error)
+	// Disconnect closes the sink. It must be safe to call on a sink that is not fully connected.
+	Disconnect()
+}
+
+type dryRun struct{}
+
+type dryRunFolder string
+
+func (f dryRunFolder) String() string {
+	return string(f)
+}
+
+// DryRun returns a Sink that does not store anything but only logs what would be done.
+func DryRun() Sink {
+	return dryRun{}
+}
+
+func (dryRun) NewFolder(path []string) Folder {
+	return dryRunFolder(strings.Join(path, "/"))
+}
+
+func (dryRun) EnsureFolder(Folder) error {
+	return nil
+}
+
+func (dryRun) PutMessages(folder Folder, messages []string) ([]Location, error) {
+	if len(messages) > 0 {
+		log.Printf("Dry run: Would store %d messages to '%s'", len(messages), folder)
+	}
+	return make([]Location, len(messages)), nil
+}
+
+func (dryRun) Replace(folder Folder, header, value, _ string, _ bool, old Location) (Location, error) {
+	log.Printf("Dry run: Would replace message with %s=%q in '%s'", header, value, folder)
+	return old, nil
+}
+
+func (dryRun) Disconnect() {}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/Necoro/feed2imap-go/internal/feed/cache"
 	"github.com/Necoro/feed2imap-go/internal/feed/template"
+	"github.com/Necoro/feed2imap-go/internal/http"
 	"github.com/Necoro/feed2imap-go/internal/imap"
+	"github.com/Necoro/feed2imap-go/internal/maildir"
+	"github.com/Necoro/feed2imap-go/internal/sink"
 	"github.com/Necoro/feed2imap-go/pkg/config"
 	"github.com/Necoro/feed2imap-go/pkg/log"
 	"github.com/Necoro/feed2imap-go/pkg/version"
@@ -22,6 +31,7 @@ var (
 	buildCache   bool = false
 	verbose      bool = false
 	debug        bool = false
+	daemon       bool = false
 )
 
 func init() {
@@ -30,51 +40,217 @@ func init() {
 	flag.BoolVar(&printVersion, "version", printVersion, "print version and exit")
 	flag.BoolVar(&dryRun, "dry-run", dryRun, "do everything short of uploading and writing the cache")
 	flag.BoolVar(&buildCache, "build-cache", buildCache, "only (re)build the cache; useful after migration or when the cache is lost or corrupted")
+	flag.BoolVar(&daemon, "daemon", daemon, "keep running and fetch each feed according to its own interval")
 	flag.BoolVar(&verbose, "v", verbose, "enable verbose output")
 	flag.BoolVar(&debug, "d", debug, "enable debug output")
 }
 
-func processFeed(cf cache.CachedFeed, client *imap.Client, dryRun bool) {
+// processFeed stores the items of the feed into its target. It returns whether this has been successful
+// and the feed should be committed.
+func processFeed(cf cache.CachedFeed, targets map[string]sink.Sink) bool {
 	feed := cf.Feed()
+	target, ok := targets[feed.Account]
+	if !ok {
+		log.Errorf("Feed %s: Target of account '%s' is not available, skipping.", feed.Name, accountName(feed.Account))
+		return false
+	}
+
 	msgs, err := feed.Messages()
 	if err != nil {
 		log.Errorf("Processing items of feed %s: %s", feed.Name, err)
-		return
+		return false
 	}
 
-	if dryRun || len(msgs) == 0 {
-		cf.Commit()
-		return
+	if len(msgs) == 0 {
+		return true
 	}
 
-	folder := client.NewFolder(feed.Target)
-	if err = client.EnsureFolder(folder); err != nil {
+	folder := target.NewFolder(feed.Target)
+	if err = target.EnsureFolder(folder); err != nil {
 		log.Errorf("Creating folder of feed %s: %s", feed.Name, err)
-		return
+		return false
 	}
 
-	if err = msgs.Upload(client, folder, feed.Reupload); err != nil {
+	if err = msgs.Upload(target, folder, feed.Reupload); err != nil {
 		log.Errorf("Uploading messages of feed %s: %s", feed.Name, err)
-		return
+		return false
 	}
+	feed.SetLocations(msgs)
 
 	log.Printf("Uploaded %d messages to '%s' @ %s", len(msgs), feed.Name, folder)
 
-	cf.Commit()
+	return true
 }
 
-func loadTemplate(path string, tpl template.Template) error {
-	if path == "" {
+func accountName(account string) string {
+	if account == "" {
+		return "default"
+	}
+	return account
+}
+
+// connect opens the sink of the given account.
+func connect(cfg *config.Config, account string) (sink.Sink, error) {
+	url, ok := cfg.AccountUrl(account)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unknown account '%s'", account)
+	case dryRun:
+		return sink.DryRun(), nil
+	case url.IsMaildir():
+		return maildir.Open(url)
+	default:
+		return imap.Connect(url, cfg.MaxConns)
+	}
+}
+
+// connectAll opens the sinks of all the given accounts in parallel.
+// Accounts that fail to connect are missing in the result.
+func connectAll(cfg *config.Config, accounts []string) (map[string]sink.Sink, error) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errs  []error
+		sinks = make(map[string]sink.Sink, len(accounts))
+	)
+
+	for _, account := range accounts {
+		wg.Go(func() {
+			target, err := connect(cfg, account)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.Errorf("Connecting account '%s': %s", accountName(account), err)
+				errs = append(errs, err)
+			} else {
+				sinks[account] = target
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(sinks) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return sinks, nil
+}
+
+// targetSet holds the connected sinks per account. A reload of the configuration may connect further accounts.
+type targetSet struct {
+	mu      sync.Mutex
+	cfg     *config.Config
+	targets map[string]sink.Sink // replaced as a whole on modification
+}
+
+func (t *targetSet) current() map[string]sink.Sink {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.targets
+}
+
+// connectNew connects those accounts of cfg, that are not yet connected, and switches to cfg.
+// A changed target of an account already connected is only applied on restart.
+// It only fails, if none of the accounts could be connected.
+func (t *targetSet) connectNew(cfg *config.Config, accounts []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var missing []string
+	for _, account := range accounts {
+		if _, ok := t.targets[account]; !ok {
+			missing = append(missing, account)
+			continue
+		}
+
+		oldUrl, _ := t.cfg.AccountUrl(account)
+		newUrl, _ := cfg.AccountUrl(account)
+		if !reflect.DeepEqual(oldUrl, newUrl) {
+			log.Warnf("Target of account '%s' has changed. This is only applied on restart.", accountName(account))
+		}
+	}
+	t.cfg = cfg
+
+	if len(missing) == 0 {
 		return nil
 	}
 
-	log.Printf("Loading custom %s template from %s", tpl.Name(), path)
+	sinks, err := connectAll(cfg, missing) // errors are logged by connectAll
+	targets := make(map[string]sink.Sink, len(t.targets)+len(sinks))
+	maps.Copy(targets, t.targets)
+	maps.Copy(targets, sinks)
+	t.targets = targets
+	return err
+}
+
+func (t *targetSet) disconnect() {
+	disconnectAll(t.current())
+}
+
+func loadTemplate(path string, tpl template.Template) error {
+	if path != "" {
+		log.Printf("Loading custom %s template from %s", tpl.Name(), path)
+	}
 	if err := tpl.LoadFile(path); err != nil {
 		return fmt.Errorf("loading %s template from %s: %w", tpl.Name(), path, err)
 	}
 	return nil
 }
 
+func loadTemplates(cfg *config.Config) error {
+	if err := loadTemplate(cfg.HtmlTemplate, template.Html); err != nil {
+		return err
+	}
+	return loadTemplate(cfg.TextTemplate, template.Text)
+}
+
+// usedAccounts returns the accounts of all feeds in the state.
+func usedAccounts(state *cache.State) []string {
+	accounts := make(map[string]struct{})
+	state.Foreach(func(cf cache.CachedFeed) {
+		accounts[cf.Feed().Account] = struct{}{}
+	})
+	return slices.Collect(maps.Keys(accounts))
+}
+
+// feedAccounts returns the accounts of the given feeds of cfg, that are not disabled.
+func feedAccounts(cfg *config.Config, names []string) []string {
+	accounts := make(map[string]struct{})
+	for _, name := range names {
+		if f, ok := cfg.Feeds[name]; ok && !f.Disable {
+			accounts[f.Account] = struct{}{}
+		}
+	}
+	return slices.Collect(maps.Keys(accounts))
+}
+
+// report lists the feeds of the run that need the attention of the user.
+func report(state *cache.State) {
+	var notes []string
+	state.Foreach(func(cf cache.CachedFeed) {
+		feed := cf.Feed()
+		switch {
+		case feed.Redirect() != "":
+			notes = append(notes, fmt.Sprintf("%s: Moved permanently to '%s'. Update the URL in the configuration.", feed.Name, feed.Redirect()))
+		case feed.Discovered() != "":
+			notes = append(notes, fmt.Sprintf("%s: URL is an HTML page linking to the feed '%s'. Update the URL in the configuration.", feed.Name, feed.Discovered()))
+		}
+	})
+
+	if len(notes) > 0 {
+		slices.Sort(notes)
+		log.Warnf("Run report -- feeds needing attention:\n\t%s", strings.Join(notes, "\n\t"))
+	}
+}
+
+func disconnectAll(targets map[string]sink.Sink) {
+	for _, target := range targets {
+		target.Disconnect()
+	}
+}
+
 func run() error {
 	flag.Parse()
 	if printVersion {
@@ -94,6 +270,7 @@ func run() error {
 	if err != nil {
 		return err
 	}
+	http.SetLimits(cfg.MaxFetches, cfg.MaxPerHost)
 
 	state, err := cache.NewState(cfg)
 	if err != nil {
@@ -112,6 +289,16 @@ func run() error {
 	}
 	defer state.UnlockCache()
 
+	if daemon {
+		if buildCache {
+			return fmt.Errorf("-daemon and -build-cache cannot be combined.")
+		}
+		if err = loadTemplates(cfg); err != nil {
+			return err
+		}
+		return runDaemon(cfg, state, cacheLocation)
+	}
+
 	state.RemoveUndue()
 
 	if state.NumFeeds() == 0 {
@@ -121,30 +308,47 @@ func run() error {
 	}
 
 	if !buildCache {
-		if err = loadTemplate(cfg.HtmlTemplate, template.Html); err != nil {
-			return err
-		}
-		if err = loadTemplate(cfg.TextTemplate, template.Text); err != nil {
+		if err = loadTemplates(cfg); err != nil {
 			return err
 		}
 	}
 
-	imapErr := make(chan error, 1)
-	var c *imap.Client
-	if !dryRun && !buildCache {
+	sinkErr := make(chan error, 1)
+	targets := &targetSet{cfg: cfg}
+	if !buildCache {
+		accounts := usedAccounts(state)
+		connected := make(chan struct{})
 		go func() {
-			var err error
-			c, err = imap.Connect(cfg.Target, cfg.MaxConns)
-			imapErr <- err
+			defer close(connected)
+			sinkErr <- targets.connectNew(cfg, accounts)
 		}()
 
 		defer func() {
-			// capture c and not evaluate it, before connect has run
-			c.Disconnect()
+			// on an early return, the connections may still be established
+			<-connected
+			targets.disconnect()
 		}()
 	}
 
+	// installed after the connections, so that it is stopped before they are closed
+	stopReload := reloadOnHangup(state, func(cfg *config.Config, changes cache.Changes) {
+		if len(changes.Added) > 0 {
+			log.Print("Added feeds are fetched on the next run.")
+		}
+		if !buildCache {
+			_ = targets.connectNew(cfg, feedAccounts(cfg, changes.Changed))
+		}
+	})
+	defer stopReload()
+
 	if success := state.Fetch(); success == 0 {
+		if !dryRun && !buildCache {
+			// keep track of the failures, so that the next run can back off
+			if err = state.StoreCache(cacheLocation); err != nil {
+				log.Error(err)
+			}
+		}
+		report(state)
 		return fmt.Errorf("No successful feed fetch.")
 	}
 
@@ -153,16 +357,18 @@ func run() error {
 	if buildCache {
 		state.Foreach(cache.CachedFeed.Commit)
 	} else {
-		if !dryRun {
-			if err = <-imapErr; err != nil {
-				return err
-			}
+		if err = <-sinkErr; err != nil {
+			return err
 		}
 		state.ForeachGo(func(f cache.CachedFeed) {
-			processFeed(f, c, dryRun)
+			if processFeed(f, targets.current()) {
+				f.Commit()
+			}
 		})
 	}
 
+	report(state)
+
 	if !dryRun {
 		if err = state.StoreCache(cacheLocation); err != nil {
 			return err
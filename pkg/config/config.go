@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/Necoro/feed2imap-go/pkg/log"
 )
@@ -17,16 +19,21 @@ type Map map[string]any
 
 // GlobalOptions are not feed specific
 type GlobalOptions struct {
-	Cache        string   `yaml:"cache"`
-	Timeout      int      `yaml:"timeout"`
-	DefaultEmail string   `yaml:"default-email"`
-	Target       Url      `yaml:"target"`
-	Parts        []string `yaml:"parts"`
-	MaxFailures  int      `yaml:"max-failures"`
-	MaxConns     int      `yaml:"max-imap-connections"`
-	AutoTarget   bool     `yaml:"auto-target"`
-	HtmlTemplate string   `yaml:"html-template"`
-	TextTemplate string   `yaml:"text-template"`
+	Cache        string        `yaml:"cache"`
+	ImageCache   string        `yaml:"image-cache"`
+	Timeout      int           `yaml:"timeout"`
+	DefaultEmail string        `yaml:"default-email"`
+	Target       Url           `yaml:"target"`
+	Accounts     Accounts      `yaml:"accounts"`
+	Parts        []string      `yaml:"parts"`
+	MaxFailures  int           `yaml:"max-failures"`
+	MaxConns     int           `yaml:"max-imap-connections"`
+	MaxFetches   int           `yaml:"max-fetches"`
+	MaxPerHost   int           `yaml:"max-fetches-per-host"`
+	AutoTarget   bool          `yaml:"auto-target"`
+	HtmlTemplate string        `yaml:"html-template"`
+	TextTemplate string        `yaml:"text-template"`
+	Interval     time.Duration `yaml:"interval"`
 }
 
 var DefaultGlobalOptions = GlobalOptions{
@@ -34,39 +41,73 @@ var DefaultGlobalOptions = GlobalOptions{
 	Timeout:      30,
 	MaxFailures:  10,
 	MaxConns:     5,
+	MaxFetches:   0,
+	MaxPerHost:   0,
 	DefaultEmail: username() + "@" + Hostname(),
 	Target:       Url{},
+	Accounts:     Accounts{},
 	Parts:        []string{"text", "html"},
 	AutoTarget:   true,
 	HtmlTemplate: "",
 	TextTemplate: "",
+	Interval:     time.Hour,
 }
 
 // Options are feed specific
 // NB: Always specify a yaml name, as it is later used in processing
 type Options struct {
-	MinFreq     int    `yaml:"min-frequency"`
-	InclImages  bool   `yaml:"include-images"`
-	EmbedImages bool   `yaml:"embed-images"`
-	Disable     bool   `yaml:"disable"`
-	IgnHash     bool   `yaml:"ignore-hash"`
-	AlwaysNew   bool   `yaml:"always-new"`
-	Reupload    bool   `yaml:"reupload-if-updated"`
-	NoTLS       bool   `yaml:"tls-no-verify"`
-	ItemFilter  string `yaml:"item-filter"`
-	Body        Body   `yaml:"body"`
+	Account      string    `yaml:"account"`
+	MinFreq      Frequency `yaml:"min-frequency"`
+	Schedule     string    `yaml:"schedule"`
+	FetchWindows []string  `yaml:"fetch-windows"`
+	InclImages   bool      `yaml:"include-images"`
+	EmbedImages  bool      `yaml:"embed-images"`
+	Disable      bool      `yaml:"disable"`
+	IgnHash      bool      `yaml:"ignore-hash"`
+	AlwaysNew    bool      `yaml:"always-new"`
+	Reupload     bool      `yaml:"reupload-if-updated"`
+	NoTLS        bool      `yaml:"tls-no-verify"`
+	TLS          TLS       `yaml:"tls"`
+	Proxy        string    `yaml:"proxy"`
+	ItemFilter   string    `yaml:"item-filter"`
+	Preprocess   []string  `yaml:"preprocess"`
+	PreprocExec  []string  `yaml:"preprocess-exec"`
+	Headers      Headers   `yaml:"headers"`
+	Auth         Auth      `yaml:"auth"`
+	Cookies      bool      `yaml:"cookies"`
+	Body         Body      `yaml:"body"`
+}
+
+// Headers are additional HTTP headers sent when fetching a feed
+type Headers map[string]Secret
+
+// Auth holds the credentials for fetching a feed: Either user and password for HTTP Basic auth, or a bearer token.
+type Auth struct {
+	User     string `yaml:"user"`
+	Password Secret `yaml:"password"`
+	Token    Secret `yaml:"token"`
 }
 
 var DefaultFeedOptions = Options{
-	Body:        "default",
-	MinFreq:     0,
-	InclImages:  true,
-	EmbedImages: false,
-	IgnHash:     false,
-	AlwaysNew:   false,
-	Disable:     false,
-	NoTLS:       false,
-	ItemFilter:  "",
+	Account:      "",
+	Body:         "default",
+	MinFreq:      0,
+	Schedule:     "",
+	FetchWindows: nil,
+	InclImages:   true,
+	EmbedImages:  false,
+	IgnHash:      false,
+	AlwaysNew:    false,
+	Disable:      false,
+	NoTLS:        false,
+	TLS:          TLS{},
+	Proxy:        "",
+	ItemFilter:   "",
+	Preprocess:   nil,
+	PreprocExec:  nil,
+	Headers:      nil,
+	Auth:         Auth{},
+	Cookies:      false,
 }
 
 // Config holds the global configuration options and the configured feeds
@@ -87,31 +128,94 @@ func WithDefault() *Config {
 
 // Validate checks the configuration against common mistakes
 func (cfg *Config) Validate() error {
-	if cfg.Target.Empty() {
+	if cfg.Target.Empty() && len(cfg.Accounts) == 0 {
 		return fmt.Errorf("No target set!")
 	}
 
-	for _, feed := range cfg.Feeds {
-		if feed.Url != "" && len(feed.Exec) > 0 {
-			return fmt.Errorf("Feed %s: Both 'Url' and 'Exec' set, unsure what to do.", feed.Name)
+	if _, ok := cfg.Accounts[""]; ok {
+		return fmt.Errorf("Accounts must not have an empty name.")
+	}
+
+	if _, err := cfg.Target.TLS.Build(false); err != nil {
+		return fmt.Errorf("Target: Invalid TLS settings: %w", err)
+	}
+	for name, account := range cfg.Accounts {
+		if _, err := account.TLS.Build(false); err != nil {
+			return fmt.Errorf("Account %s: Invalid TLS settings: %w", name, err)
 		}
 	}
 
-	if cfg.Target.EmptyRoot() {
-		for _, feed := range cfg.Feeds {
-			if len(feed.Target) == 0 {
-				return fmt.Errorf("Feed %s: No storage location (target) defined.", feed.Name)
+	stdinFeed := ""
+	for _, feed := range cfg.Feeds {
+		if feed.numSources() > 1 {
+			return fmt.Errorf("Feed %s: More than one of 'Url', 'Exec', 'Scrape', and 'Json' set, unsure what to do.", feed.Name)
+		}
+
+		if feed.Scrape != nil && (feed.Scrape.Url == "" || feed.Scrape.Item == "") {
+			return fmt.Errorf("Feed %s: 'scrape' needs at least 'url' and 'item'.", feed.Name)
+		}
+
+		if feed.Json != nil && feed.Json.Url == "" {
+			return fmt.Errorf("Feed %s: 'json' needs an 'url'.", feed.Name)
+		}
+
+		if _, err := feed.TLS.Build(feed.NoTLS); err != nil {
+			return fmt.Errorf("Feed %s: Invalid TLS settings: %w", feed.Name, err)
+		}
+
+		if feed.Auth.Token != "" && (feed.Auth.User != "" || feed.Auth.Password != "") {
+			return fmt.Errorf("Feed %s: 'auth' takes either 'user' and 'password' or a 'token', but not both.", feed.Name)
+		}
+
+		if pattern, ok := feed.FilePattern(); ok {
+			if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" {
+				return fmt.Errorf("Feed %s: Invalid file path '%s'.", feed.Name, pattern)
+			}
+		}
+
+		if feed.IsStdin() {
+			if stdinFeed != "" {
+				return fmt.Errorf("Feed %s: Only one feed can be read from stdin, but '%s' does so already.", feed.Name, stdinFeed)
 			}
+			stdinFeed = feed.Name
+		}
+
+		target, ok := cfg.AccountUrl(feed.Account)
+		switch {
+		case !ok:
+			return fmt.Errorf("Feed %s: Unknown account '%s'.", feed.Name, feed.Account)
+		case target.Empty():
+			return fmt.Errorf("Feed %s: No target set and no account given.", feed.Name)
+		case target.EmptyRoot() && len(feed.Target) == 0:
+			return fmt.Errorf("Feed %s: No storage location (target) defined.", feed.Name)
 		}
 	}
 
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("interval is '%s', but must be positive.", cfg.Interval)
+	}
+
 	if cfg.MaxConns < 1 {
 		return fmt.Errorf("max-imap-connections is '%d', but must be at least 1.", cfg.MaxConns)
 	}
 
+	if cfg.MaxFetches < 0 || cfg.MaxPerHost < 0 {
+		return fmt.Errorf("max-fetches and max-fetches-per-host must not be negative.")
+	}
+
 	return nil
 }
 
+// AccountUrl returns the target URL of the named account.
+// The empty name denotes the global target.
+func (cfg *Config) AccountUrl(name string) (Url, bool) {
+	if name == "" {
+		return cfg.Target, true
+	}
+	url, ok := cfg.Accounts[name]
+	return url, ok
+}
+
 // WithPartText marks whether 'text' part should be included in mails
 func (opt GlobalOptions) WithPartText() bool {
 	return slices.Contains(opt.Parts, "text")
@@ -139,7 +243,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	if stat.Mode().Perm()&0004 != 0 {
-		log.Warnf("Config file '%s' can be read by anyone. As this contains your IMAP credentials, you are advised to remove global read access.", path)
+		log.Warnf("Config file '%s' can be read by anyone. As this contains your IMAP credentials, you are advised to remove global read access (or to move them out, e.g. via 'password-command').", path)
 	}
 
 	cfg := WithDefault()
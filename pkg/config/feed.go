@@ -1,13 +1,86 @@
 package config
 
+import "strings"
+
+// StdinUrl as the URL of a feed denotes reading the feed from stdin.
+const StdinUrl = "-"
+
+const fileScheme = "file://"
+
 // One stored feed
 type Feed struct {
 	Name   string
 	Target []string
 	Url    string
 	Exec   []string
+	Scrape *Scrape
+	Json   *JsonApi
 	Options
 }
 
+// Scrape describes how to extract the items from a website without a feed.
+// Each selector is a CSS selector, relative to the item. It may be followed by '@attr' to use the value
+// of the attribute instead of the contents of the selected element.
+type Scrape struct {
+	Url     string `yaml:"url"`
+	Item    string `yaml:"item"`    // selects the element containing an item
+	Title   string `yaml:"title"`   // default: text of the link
+	Link    string `yaml:"link"`    // default: first link in the item
+	Date    string `yaml:"date"`    // default: first <time> element in the item
+	Content string `yaml:"content"` // default: the item itself
+}
+
+// JsonApi describes how to map the response of a JSON API onto feed items.
+// Each field is an expression (same language as 'item-filter'), evaluated on an element of the JSON array
+// selected by Items. Missing keys evaluate to nil.
+type JsonApi struct {
+	Url     string `yaml:"url"`
+	Items   string `yaml:"items"`   // evaluated on the whole response; default: the response itself
+	Title   string `yaml:"title"`   // default: title
+	Link    string `yaml:"link"`    // default: link
+	Guid    string `yaml:"guid"`    // default: id, falling back to the link
+	Date    string `yaml:"date"`    // default: date
+	Content string `yaml:"content"` // default: content
+	Authors string `yaml:"authors"` // a string or a list of strings or of objects with 'name' and 'email'; default: none
+}
+
+// numSources returns how many sources (url, exec, scrape, json) are set for the feed.
+func (feed *Feed) numSources() int {
+	n := 0
+	if feed.Url != "" {
+		n++
+	}
+	if len(feed.Exec) > 0 {
+		n++
+	}
+	if feed.Scrape != nil {
+		n++
+	}
+	if feed.Json != nil {
+		n++
+	}
+	return n
+}
+
+// IsStdin returns whether the feed is read from stdin.
+func (feed *Feed) IsStdin() bool {
+	return feed.Url == StdinUrl
+}
+
+// FilePattern returns the path (or glob pattern) of a feed read from local files, i.e., with a 'file://' URL.
+// Relative paths ('file://feeds/foo.xml') are relative to the working directory.
+func (feed *Feed) FilePattern() (string, bool) {
+	return strings.CutPrefix(feed.Url, fileScheme)
+}
+
+// IsFile returns whether the feed is read from local files.
+func (feed *Feed) IsFile() bool {
+	_, ok := feed.FilePattern()
+	return ok
+}
+
 // Convenience type for all feeds
 type Feeds map[string]*Feed
+
+// Accounts maps the name of an account onto its target URL
+type Accounts map[string]Url
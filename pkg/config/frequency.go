@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Frequency is the minimal time between two updates of a feed.
+// It is given either as a duration ("15m", "1h30m") or, for backward compatibility, as a plain number of hours.
+type Frequency time.Duration
+
+func Hours(h int) Frequency {
+	return Frequency(time.Duration(h) * time.Hour)
+}
+
+func (f Frequency) Duration() time.Duration {
+	return time.Duration(f)
+}
+
+func (f Frequency) String() string {
+	return time.Duration(f).String()
+}
+
+func parseFrequency(value any) (Frequency, error) {
+	var (
+		freq Frequency
+		err  error
+	)
+
+	switch v := value.(type) {
+	case int:
+		freq = Hours(v)
+	case string:
+		v = strings.TrimSpace(v)
+		if h, convErr := strconv.Atoi(v); convErr == nil {
+			freq = Hours(h)
+		} else {
+			var d time.Duration
+			d, err = time.ParseDuration(v)
+			freq = Frequency(d)
+		}
+	default:
+		return 0, fmt.Errorf("invalid value for 'min-frequency': %v", value)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for 'min-frequency': %w", err)
+	}
+	if freq < 0 {
+		return 0, fmt.Errorf("'min-frequency' must not be negative, got %q", value)
+	}
+	return freq, nil
+}
+
+func (f *Frequency) UnmarshalYAML(node *yaml.Node) error {
+	var val any
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+
+	freq, err := parseFrequency(val)
+	if err != nil {
+		return TypeError("line %d: %s", node.Line, err)
+	}
+
+	*f = freq
+	return nil
+}
+
+// frequencyHook allows mapstructure to decode a Frequency the same way as yaml does.
+func frequencyHook(_ reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeFor[Frequency]() {
+		return data, nil
+	}
+	return parseFrequency(data)
+}
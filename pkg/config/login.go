@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SASL mechanisms supported for the IMAP login
+const (
+	MechLogin       = "login" // the IMAP LOGIN command, not the SASL mechanism
+	MechPlain       = "plain"
+	MechScramSha1   = "scram-sha-1"
+	MechScramSha256 = "scram-sha-256"
+	MechXOAuth2     = "xoauth2"
+	MechOAuthBearer = "oauthbearer"
+)
+
+var mechanisms = []string{MechLogin, MechPlain, MechScramSha1, MechScramSha256, MechXOAuth2, MechOAuthBearer}
+
+// Login configures how to authenticate against the IMAP server. The password (or token) is taken from,
+// in this order: the OAuth2 refresh, the command, the file, or the password of the URL.
+// Command and file are consulted on each login, so that they may hand out fresh tokens.
+type Login struct {
+	Mechanism string  `yaml:"mechanism"` // default: login
+	Command   Command `yaml:"command"`   // prints the password or token on stdout
+	File      string  `yaml:"file"`      // contains the password or token
+	OAuth2    *OAuth2 `yaml:"oauth2"`
+}
+
+// OAuth2 holds the settings to obtain access tokens via an OAuth2 refresh token.
+type OAuth2 struct {
+	TokenUrl     string `yaml:"token-url"`
+	ClientId     string `yaml:"client-id"`
+	ClientSecret Secret `yaml:"client-secret"`
+	RefreshToken Secret `yaml:"refresh-token"`
+	Scope        string `yaml:"scope"`
+	TokenFile    string `yaml:"token-file"` // stores the refresh token, if the provider replaces it; default: in the user's cache dir
+}
+
+func (l *Login) Empty() bool {
+	return l.Mechanism == "" && len(l.Command) == 0 && l.File == "" && l.OAuth2 == nil
+}
+
+// IsOAuth returns whether the mechanism expects an OAuth2 access token instead of a password.
+func (l *Login) IsOAuth() bool {
+	return l.Mechanism == MechXOAuth2 || l.Mechanism == MechOAuthBearer
+}
+
+func (l *Login) sanitize() {
+	l.Mechanism = strings.ToLower(l.Mechanism)
+	l.File = expandHome(l.File)
+	if l.OAuth2 != nil {
+		l.OAuth2.TokenFile = expandHome(l.OAuth2.TokenFile)
+	}
+}
+
+func (l *Login) validate(password Secret) (errors []string) {
+	if l.Mechanism != "" && !slices.Contains(mechanisms, l.Mechanism) {
+		errors = append(errors, fmt.Sprintf("Unknown auth mechanism %q, expected one of %s",
+			l.Mechanism, strings.Join(mechanisms, ", ")))
+	}
+
+	sources := 0
+	for _, given := range []bool{password != "", len(l.Command) > 0, l.File != "", l.OAuth2 != nil} {
+		if given {
+			sources++
+		}
+	}
+	if sources > 1 {
+		errors = append(errors, "Only one of password, password command, password file, and oauth2 may be given")
+	}
+
+	if o := l.OAuth2; o != nil {
+		if !l.IsOAuth() {
+			errors = append(errors, fmt.Sprintf("oauth2 needs mechanism %s or %s", MechXOAuth2, MechOAuthBearer))
+		}
+		if o.TokenUrl == "" || o.ClientId == "" || o.RefreshToken == "" {
+			errors = append(errors, "oauth2 needs token-url, client-id, and refresh-token")
+		}
+	}
+
+	return
+}
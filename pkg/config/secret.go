@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret is a credential. In the configuration, it is given either as plain string,
+// or read from a file ({file: PATH}), an environment variable ({env: NAME}), or the output of a command ({command: CMD}).
+type Secret string
+
+const commandTimeout = 30 * time.Second
+
+// Command is an external command with its arguments. In the configuration, it is given either as list,
+// or as a string that is split at whitespace (no shell is involved).
+type Command []string
+
+func parseCommand(value any) (Command, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.Fields(v), nil
+	case []any:
+		cmd := make(Command, len(v))
+		for i, arg := range v {
+			var ok bool
+			if cmd[i], ok = arg.(string); !ok {
+				return nil, fmt.Errorf("invalid command, argument %v is not a string", arg)
+			}
+		}
+		return cmd, nil
+	}
+	return nil, fmt.Errorf("invalid command, expected a string or a list")
+}
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	var val any
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+
+	cmd, err := parseCommand(val)
+	if err != nil {
+		return TypeError("line %d: %s", node.Line, err)
+	}
+
+	*c = cmd
+	return nil
+}
+
+// Output runs the command and returns its output, without trailing newlines.
+func (c Command) Output() (string, error) {
+	if len(c) == 0 {
+		return "", errors.New("empty command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c[0], c[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("running '%s': %w (%s)", c[0], err, msg)
+		}
+		return "", fmt.Errorf("running '%s': %w", c[0], err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func parseSecret(value any) (Secret, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return Secret(v), nil
+	case Map:
+		return parseSecret(map[string]any(v))
+	case map[string]any:
+		if len(v) != 1 {
+			break
+		}
+		if file, ok := v["file"].(string); ok {
+			content, err := os.ReadFile(expandHome(file))
+			if err != nil {
+				return "", fmt.Errorf("reading secret: %w", err)
+			}
+			return Secret(strings.TrimRight(string(content), "\r\n")), nil
+		}
+		if env, ok := v["env"].(string); ok {
+			val, ok := os.LookupEnv(env)
+			if !ok {
+				return "", fmt.Errorf("environment variable '%s' of secret is not set", env)
+			}
+			return Secret(val), nil
+		}
+		if command, ok := v["command"]; ok {
+			cmd, err := parseCommand(command)
+			if err != nil {
+				return "", err
+			}
+			out, err := cmd.Output()
+			if err != nil {
+				return "", fmt.Errorf("reading secret: %w", err)
+			}
+			return Secret(out), nil
+		}
+	}
+	return "", fmt.Errorf("invalid secret, expected a string, {file: PATH}, {env: NAME}, or {command: CMD}")
+}
+
+func (s *Secret) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() != nullTag {
+		// numbers and booleans are taken by their literal text
+		*s = Secret(node.Value)
+		return nil
+	}
+
+	var val any
+	if err := node.Decode(&val); err != nil {
+		return err
+	}
+
+	secret, err := parseSecret(val)
+	if err != nil {
+		return TypeError("line %d: %s", node.Line, err)
+	}
+
+	*s = secret
+	return nil
+}
+
+// secretHook allows mapstructure to decode a Secret the same way as yaml does.
+func secretHook(_ reflect.Type, to reflect.Type, data any) (any, error) {
+	if to != reflect.TypeFor[Secret]() {
+		return data, nil
+	}
+	switch data.(type) {
+	case int, int64, uint64, float64, bool:
+		// the literal text is gone at this point, but this is what it looks like in most cases
+		return Secret(fmt.Sprint(data)), nil
+	}
+	return parseSecret(data)
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// TLS holds custom settings for TLS connections: Additional CAs to trust, a client certificate, and pinned keys.
+type TLS struct {
+	CA   string   `yaml:"ca"`   // PEM file with CA certificates, trusted in addition to the system ones
+	Cert string   `yaml:"cert"` // PEM file with the client certificate (may include the key)
+	Key  string   `yaml:"key"`  // PEM file with the key of the client certificate; default: cert
+	Pins []string `yaml:"pins"` // base64 encoded SHA-256 hashes of the public key (SPKI) of a certificate in the chain (only the leaf, if not verified)
+}
+
+// Empty returns whether no custom settings are given.
+func (t *TLS) Empty() bool {
+	return t.CA == "" && t.Cert == "" && t.Key == "" && len(t.Pins) == 0
+}
+
+// SPKIHash returns the pin of the certificate, as used in TLS.Pins.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Build creates the TLS configuration. It returns nil for empty settings, so that the defaults are used.
+// When insecure is set, the certificate of the server is not verified -- but the pins, if any, are still checked.
+func (t *TLS) Build(insecure bool) (*tls.Config, error) {
+	if t.Empty() {
+		if insecure {
+			return &tls.Config{InsecureSkipVerify: true}, nil
+		}
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+
+	if t.CA != "" {
+		pem, err := os.ReadFile(expandHome(t.CA))
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle '%s'", t.CA)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.Cert != "" || t.Key != "" {
+		if t.Cert == "" {
+			return nil, errors.New("client key given without certificate")
+		}
+		key := t.Key
+		if key == "" {
+			key = t.Cert
+		}
+		cert, err := tls.LoadX509KeyPair(expandHome(t.Cert), expandHome(key))
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(t.Pins) > 0 {
+		pins := make([]string, len(t.Pins))
+		for i, pin := range t.Pins {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin '%s', expected a base64 encoded SHA-256 hash", t.Pins[i])
+			}
+			pins[i] = pin
+		}
+
+		// called after the regular verification (if enabled)
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			// the certificates sent by the server are arbitrary: only consider those of the verified chains,
+			// or, without verification, the leaf
+			var certs []*x509.Certificate
+			if insecure {
+				if len(cs.PeerCertificates) > 0 {
+					certs = cs.PeerCertificates[:1]
+				}
+			} else {
+				for _, chain := range cs.VerifiedChains {
+					certs = append(certs, chain...)
+				}
+			}
+
+			for _, cert := range certs {
+				if slices.Contains(pins, SPKIHash(cert)) {
+					return nil
+				}
+			}
+			return errors.New("no certificate of the server matches the pinned keys")
+		}
+	}
+
+	return cfg, nil
+}
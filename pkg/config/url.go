@@ -4,21 +4,32 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Url struct {
-	Scheme   string `yaml:"scheme"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	Root     string `yaml:"root"`
+	Scheme          string  `yaml:"scheme"`
+	User            string  `yaml:"user"`
+	Password        Secret  `yaml:"password"`
+	PasswordCommand Command `yaml:"password-command"` // shorthand for auth.command
+	PasswordFile    string  `yaml:"password-file"`    // shorthand for auth.file
+	Host            string  `yaml:"host"`
+	Port            string  `yaml:"port"`
+	Root            string  `yaml:"root"`
+	Layout          string  `yaml:"layout"`
+	TLS             TLS     `yaml:"tls"`
+	Auth            Login   `yaml:"auth"`
 }
 
 func (u *Url) Empty() bool {
+	if u.IsMaildir() {
+		return u.Root == ""
+	}
 	return u.Host == ""
 }
 
@@ -40,10 +51,26 @@ func (u *Url) UnmarshalYAML(value *yaml.Node) (err error) {
 
 		u.Scheme = rawUrl.Scheme
 		u.User = rawUrl.User.Username()
-		u.Password, _ = rawUrl.User.Password()
+		password, _ := rawUrl.User.Password()
+		u.Password = Secret(password)
 		u.Host = rawUrl.Hostname()
 		u.Port = rawUrl.Port()
 		u.Root = rawUrl.Path
+		query := rawUrl.Query()
+		u.Layout = query.Get("layout")
+		u.TLS = TLS{
+			CA:   query.Get("tls-ca"),
+			Cert: query.Get("tls-cert"),
+			Key:  query.Get("tls-key"),
+			Pins: query["tls-pin"],
+		}
+		u.Auth = Login{Mechanism: query.Get("auth")}
+
+		if u.Scheme == maildirSchema && u.Host != "" {
+			// maildir://~/Mail or maildir://relative/path -- the "host" is part of the path
+			u.Root = u.Host + u.Root
+			u.Host = ""
+		}
 	} else {
 		type _url Url // avoid recursion
 		wrapped := (*_url)(u)
@@ -70,6 +97,11 @@ func (u Url) String() string {
 	sb.WriteString(u.Scheme)
 	sb.WriteString("://")
 
+	if u.IsMaildir() {
+		sb.WriteString(u.Root)
+		return sb.String()
+	}
+
 	if u.User != "" {
 		sb.WriteString(u.User)
 		if u.Password != "" {
@@ -104,7 +136,16 @@ const (
 	imapsSchemaFull   = imapsSchema + "://"
 	imapSchema        = "imap"
 	imapSchemaFull    = imapSchema + "://"
-	maildirSchemaFull = "maildir://"
+	maildirSchema     = "maildir"
+	maildirSchemaFull = maildirSchema + "://"
+)
+
+// Layouts of a maildir hierarchy
+const (
+	// LayoutMaildirPP denotes Maildir++: all subfolders reside as dot-separated directories inside the root maildir.
+	LayoutMaildirPP = "maildir++"
+	// LayoutNested denotes a filesystem hierarchy, where each folder is a maildir on its own.
+	LayoutNested = "nested"
 )
 
 func isRecognizedUrl(s string) bool {
@@ -120,6 +161,11 @@ func isMaildirUrl(s string) bool {
 	return strings.HasPrefix(s, maildirSchemaFull)
 }
 
+// IsMaildir marks whether this URL points to a local maildir instead of an IMAP server.
+func (u *Url) IsMaildir() bool {
+	return u.Scheme == maildirSchema
+}
+
 func (u *Url) ForceTLS() bool {
 	return u.Scheme == imapsSchema || u.Port == imapsPort
 }
@@ -146,10 +192,40 @@ func (u *Url) setDefaultPort() {
 
 func (u *Url) sanitize() {
 	u.setDefaultScheme()
+	if u.IsMaildir() {
+		if u.Layout == "" {
+			u.Layout = LayoutMaildirPP
+		}
+		u.Root = expandHome(u.Root)
+		return
+	}
 	u.setDefaultPort()
+
+	if len(u.Auth.Command) == 0 {
+		u.Auth.Command, u.PasswordCommand = u.PasswordCommand, nil
+	}
+	if u.Auth.File == "" {
+		u.Auth.File, u.PasswordFile = u.PasswordFile, ""
+	}
+	u.Auth.sanitize()
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
 }
 
 func (u *Url) validate() (errors []string) {
+	if u.IsMaildir() {
+		return u.validateMaildir()
+	}
+
 	if u.Scheme != imapSchema && u.Scheme != imapsSchema {
 		errors = append(errors, fmt.Sprintf("Unknown scheme %q", u.Scheme))
 	}
@@ -158,18 +234,53 @@ func (u *Url) validate() (errors []string) {
 		errors = append(errors, "Host not set")
 	}
 
+	if len(u.PasswordCommand) > 0 || u.PasswordFile != "" {
+		errors = append(errors, "password-command and password-file must not be combined with their counterparts in auth")
+	}
+
+	errors = append(errors, u.Auth.validate(u.Password)...)
+
+	return
+}
+
+func (u *Url) validateMaildir() (errors []string) {
+	if u.Root == "" {
+		errors = append(errors, "Maildir path not set")
+	}
+
+	if u.Host != "" || u.Port != "" || u.User != "" || u.Password != "" ||
+		len(u.PasswordCommand) > 0 || u.PasswordFile != "" {
+		errors = append(errors, "Maildir does not support host, port or credentials")
+	}
+
+	if !u.TLS.Empty() {
+		errors = append(errors, "Maildir does not support TLS settings")
+	}
+
+	if !u.Auth.Empty() {
+		errors = append(errors, "Maildir does not support auth settings")
+	}
+
+	if u.Layout != LayoutMaildirPP && u.Layout != LayoutNested {
+		errors = append(errors, fmt.Sprintf("Unknown maildir layout %q", u.Layout))
+	}
+
 	return
 }
 
 func (u Url) BaseUrl() Url {
 	// 'u' is not a pointer and thus a copy, modification is fine
-	u.Root = ""
+	if u.IsMaildir() {
+		// for maildir, the base is the filesystem root; the full path is then part of the folder
+		u.Root = "/"
+	} else {
+		u.Root = ""
+	}
 	return u
 }
 
 func (u *Url) CommonBaseUrl(other Url) bool {
-	other.Root = ""
-	return other == u.BaseUrl()
+	return reflect.DeepEqual(other.BaseUrl(), u.BaseUrl())
 }
 
 func (u *Url) RootPath() []string {
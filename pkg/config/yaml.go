@@ -1,10 +1,13 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"maps"
+	"slices"
+	"path/filepath"
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
@@ -30,9 +33,11 @@ type group struct {
 }
 
 type feed struct {
-	Name string
-	Url  string
-	Exec []string
+	Name   string
+	Url    string
+	Exec   []string
+	Scrape *Scrape
+	Json   *JsonApi
 }
 
 type configGroupFeed struct {
@@ -47,7 +52,8 @@ func (grpFeed *configGroupFeed) isGroup() bool {
 }
 
 func (grpFeed *configGroupFeed) isFeed() bool {
-	return grpFeed.Feed.Name != "" || grpFeed.Feed.Url != "" || len(grpFeed.Feed.Exec) > 0
+	return grpFeed.Feed.Name != "" || grpFeed.Feed.Url != "" || len(grpFeed.Feed.Exec) > 0 ||
+		grpFeed.Feed.Scrape != nil || grpFeed.Feed.Json != nil
 }
 
 func (grpFeed *configGroupFeed) target(autoTarget bool) string {
@@ -70,19 +76,31 @@ func (grpFeed *configGroupFeed) target(autoTarget bool) string {
 func unmarshal(in io.Reader, cfg *Config) (config, error) {
 	parsedCfg := config{Config: cfg}
 
-	d := yaml.NewDecoder(in)
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return config{}, err
+	}
+	data, lines, err := expandEnv(data)
+	if err != nil {
+		return config{}, err
+	}
+
+	d := yaml.NewDecoder(bytes.NewReader(data))
 	d.KnownFields(true)
 	if err := d.Decode(&parsedCfg); err != nil && err != io.EOF {
-		return config{}, err
+		return config{}, lines.fix(err)
 	}
 
 	return parsedCfg, nil
 }
 
-func (cfg *Config) fixGlobalOptions(unparsed Map) {
+func (cfg *Config) fixGlobalOptions(unparsed Map) error {
 	origMap := maps.Clone(unparsed)
 
-	newOpts, _ := buildOptions(&cfg.FeedOptions, unparsed)
+	newOpts, _, err := buildOptions(&cfg.FeedOptions, unparsed)
+	if err != nil {
+		return err
+	}
 
 	for k, v := range origMap {
 		if _, ok := unparsed[k]; !ok {
@@ -93,6 +111,7 @@ func (cfg *Config) fixGlobalOptions(unparsed Map) {
 	}
 
 	cfg.FeedOptions = newOpts
+	return nil
 }
 
 func (cfg *Config) parse(in io.Reader) error {
@@ -112,9 +131,12 @@ func (cfg *Config) parse(in io.Reader) error {
 		return fmt.Errorf("while unmarshalling: %w", err)
 	}
 
-	cfg.fixGlobalOptions(parsedCfg.GlobalConfig)
+	if err = cfg.fixGlobalOptions(parsedCfg.GlobalConfig); err != nil {
+		return err
+	}
+	cfg.ImageCache = expandHome(cfg.ImageCache)
 
-	if err := buildFeeds(parsedCfg.Feeds, []string{}, cfg.Feeds, &cfg.FeedOptions, cfg.AutoTarget, &cfg.Target); err != nil {
+	if err := buildFeeds(parsedCfg.Feeds, []string{}, cfg.Feeds, &cfg.FeedOptions, cfg.AutoTarget, &cfg.Target, cfg.Accounts); err != nil {
 		return err
 	}
 
@@ -135,20 +157,23 @@ func appTarget(target []string, app string) []string {
 	}
 }
 
-func buildOptions(globalFeedOptions *Options, options Map) (Options, []string) {
+func buildOptions(globalFeedOptions *Options, options Map) (Options, []string, error) {
 	// copy global as default
 	feedOptions := *globalFeedOptions
 
 	if options == nil {
 		// no options set for the feed: copy global options and be done
-		return feedOptions, []string{}
+		return feedOptions, []string{}, nil
 	}
 
 	var md mapstructure.Metadata
 	mapstructureConfig := mapstructure.DecoderConfig{
-		TagName:  "yaml",
-		Metadata: &md,
-		Result:   &feedOptions,
+		TagName:    "yaml",
+		Metadata:   &md,
+		Result:     &feedOptions,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(frequencyHook, secretHook),
+		// lists and maps replace the inherited ones instead of being merged into them (and thus modifying those)
+		ZeroFields: true,
 	}
 
 	var err error
@@ -159,26 +184,31 @@ func buildOptions(globalFeedOptions *Options, options Map) (Options, []string) {
 
 	err = dec.Decode(options)
 	if err != nil {
-		panic(err)
+		return Options{}, nil, err
 	}
 
-	return feedOptions, md.Unused
+	return feedOptions, md.Unused, nil
 }
 
 // Fetch the group structure and populate the `targetStr` fields in the feeds
 func buildFeeds(cfg []configGroupFeed, target []string, feeds Feeds,
-	globalFeedOptions *Options, autoTarget bool, globalTarget *Url) (err error) {
+	globalFeedOptions *Options, autoTarget bool, globalTarget *Url, accounts Accounts) (err error) {
 
 	for _, f := range cfg {
-		var fTarget []string
+		var (
+			fTarget    []string
+			urlAccount *string
+		)
 
 		rawTarget := f.target(autoTarget)
 		if isRecognizedUrl(rawTarget) {
 			// deprecated old-style URLs as target
 			// as the full path is specified, `target` is ignored
-			if fTarget, err = handleUrlTarget(rawTarget, &f.Target, globalTarget); err != nil {
+			var account string
+			if fTarget, account, err = handleUrlTarget(rawTarget, &f.Target, globalTarget, accounts); err != nil {
 				return err
 			}
+			urlAccount = &account
 		} else {
 			// new-style tree-like structure
 			fTarget = appTarget(target, rawTarget)
@@ -199,11 +229,17 @@ func buildFeeds(cfg []configGroupFeed, target []string, feeds Feeds,
 			if len(f.Group.Feeds) > 0 {
 				return fmt.Errorf("Feed '%s' tries to also be a group.", name)
 			}
-			if f.Feed.Url == "" && len(f.Feed.Exec) == 0 {
-				return fmt.Errorf("Feed '%s' has not specified a URL or an Exec clause.", name)
+			if f.Feed.Url == "" && len(f.Feed.Exec) == 0 && f.Feed.Scrape == nil && f.Feed.Json == nil {
+				return fmt.Errorf("Feed '%s' has not specified a URL, an Exec, a Scrape, or a Json clause.", name)
 			}
 
-			opt, unknown := buildOptions(globalFeedOptions, f.Options)
+			opt, unknown, err := buildOptions(globalFeedOptions, f.Options)
+			if err != nil {
+				return fmt.Errorf("Feed '%s': %w", name, err)
+			}
+			if urlAccount != nil {
+				opt.Account = *urlAccount
+			}
 
 			for _, optName := range unknown {
 				if !handleDeprecated(optName, f.Options[optName], name, nil, &opt) {
@@ -215,6 +251,8 @@ func buildFeeds(cfg []configGroupFeed, target []string, feeds Feeds,
 				Name:    name,
 				Url:     f.Feed.Url,
 				Exec:    f.Feed.Exec,
+				Scrape:  f.Feed.Scrape,
+				Json:    f.Feed.Json,
 				Options: opt,
 				Target:  fTarget,
 			}
@@ -224,13 +262,19 @@ func buildFeeds(cfg []configGroupFeed, target []string, feeds Feeds,
 				log.Warnf("Group '%s' does not contain any feeds.", f.Group.Group)
 			}
 
-			opt, unknown := buildOptions(globalFeedOptions, f.Options)
+			opt, unknown, err := buildOptions(globalFeedOptions, f.Options)
+			if err != nil {
+				return fmt.Errorf("Group '%s': %w", f.Group.Group, err)
+			}
+			if urlAccount != nil {
+				opt.Account = *urlAccount
+			}
 
 			for _, optName := range unknown {
 				log.Warnf("Unknown option '%s' for group '%s'. Ignored!", optName, f.Group.Group)
 			}
 
-			if err = buildFeeds(f.Group.Feeds, fTarget, feeds, &opt, autoTarget, globalTarget); err != nil {
+			if err = buildFeeds(f.Group.Feeds, fTarget, feeds, &opt, autoTarget, globalTarget, accounts); err != nil {
 				return err
 			}
 		}
@@ -239,29 +283,68 @@ func buildFeeds(cfg []configGroupFeed, target []string, feeds Feeds,
 	return nil
 }
 
-func handleUrlTarget(targetStr string, targetNode *yaml.Node, globalTarget *Url) ([]string, error) {
+// handleUrlTarget returns the folder path and the name of the account denoted by the old-style URL target.
+func handleUrlTarget(targetStr string, targetNode *yaml.Node, globalTarget *Url, accounts Accounts) ([]string, string, error) {
 	// this whole function is solely for compatibility with old feed2imap
 	// there it was common to specify the whole URL for each feed
-	if isMaildirUrl(targetStr) {
-		// old feed2imap supported maildir, we don't
-		return nil, fmt.Errorf("Line %d: Maildir is not supported.", targetNode.Line)
-	}
-
 	url := Url{}
 	if err := url.UnmarshalYAML(targetNode); err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if isMaildirUrl(targetStr) {
+		// old feed2imap specified the full path of each maildir
+		url.Layout = LayoutNested
+		if absRoot, err := filepath.Abs(url.Root); err == nil {
+			url.Root = absRoot
+		}
 	}
 
 	if globalTarget.Empty() {
 		// assign first feed as global url
 		*globalTarget = url.BaseUrl()
-	} else if !globalTarget.CommonBaseUrl(url) {
-		// if we have a url, it must be the same prefix as the global url
-		return nil, fmt.Errorf("Line %d: Given URL endpoint '%s' does not match previous endpoint '%s'.",
-			targetNode.Line,
-			url.BaseUrl(),
-			globalTarget.BaseUrl())
 	}
 
-	return url.RootPath(), nil
+	return url.RootPath(), urlAccount(url, globalTarget, accounts), nil
+}
+
+// urlAccount finds the account sharing the endpoint with url. If there is none, a new one is created.
+func urlAccount(url Url, globalTarget *Url, accounts Accounts) string {
+	if globalTarget.CommonBaseUrl(url) {
+		return ""
+	}
+
+	// sorted, so that the same account is found on every run
+	for _, name := range slices.Sorted(maps.Keys(accounts)) {
+		if accUrl := accounts[name]; accUrl.CommonBaseUrl(url) {
+			return name
+		}
+	}
+
+	base := url.BaseUrl()
+	baseName := autoAccountName(base)
+	name := baseName
+	for i := 2; ; i++ {
+		if _, ok := accounts[name]; !ok {
+			break
+		}
+		// same name, but e.g. different port or credentials
+		name = fmt.Sprintf("%s (%d)", baseName, i)
+	}
+
+	log.Printf("Created account '%s' for endpoint of old-style target.", name)
+	accounts[name] = base
+	return name
+}
+
+// autoAccountName returns the name of an account created for an old-style target: user@host, or just the host.
+func autoAccountName(base Url) string {
+	switch {
+	case base.IsMaildir():
+		return maildirSchema
+	case base.User != "":
+		return base.User + "@" + base.Host
+	default:
+		return base.Host
+	}
 }
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"gopkg.in/yaml.v3"
@@ -31,22 +34,44 @@ func TestBuildOptions(tst *testing.T) {
 		unknowns []string
 	}{
 		{"Empty", nil, Options{}, Options{}, []string{}},
-		{"Simple copy", nil, Options{MinFreq: 75}, Options{MinFreq: 75}, []string{}},
+		{"Simple copy", nil, Options{MinFreq: Hours(75)}, Options{MinFreq: Hours(75)}, []string{}},
 		{"Unknowns", Map{"foo": 1}, Options{}, Options{}, []string{"foo"}},
 		{"Override", Map{"include-images": true}, Options{InclImages: false}, Options{InclImages: true}, []string{}},
 		{"Non-Standard Type", Map{"body": "both"}, Options{}, Options{Body: "both"}, []string{}},
-		{"Mixed", Map{"min-frequency": 24}, Options{MinFreq: 6, InclImages: true}, Options{MinFreq: 24, InclImages: true}, []string{}},
+		{"Mixed", Map{"min-frequency": 24}, Options{MinFreq: Hours(6), InclImages: true}, Options{MinFreq: Hours(24), InclImages: true}, []string{}},
+		{"Duration", Map{"min-frequency": "1h30m"}, Options{MinFreq: Hours(6)}, Options{MinFreq: Frequency(90 * time.Minute)}, []string{}},
+		{"Schedule",
+			Map{"schedule": "0 6 * * 1-5", "fetch-windows": []any{"Mon-Fri 6-22"}},
+			Options{},
+			Options{Schedule: "0 6 * * 1-5", FetchWindows: []string{"Mon-Fri 6-22"}},
+			[]string{},
+		},
+		{"Auth",
+			Map{"auth": Map{"user": "me", "password": "secret"}, "headers": Map{"X-Foo": "bar"}, "cookies": true},
+			Options{Headers: Headers{"Accept": "*/*"}},
+			Options{Auth: Auth{User: "me", Password: "secret"}, Headers: Headers{"X-Foo": "bar"}, Cookies: true},
+			[]string{},
+		},
+		{"Numeric Header",
+			Map{"headers": Map{"X-Api-Version": 2}, "auth": Map{"token": true}},
+			Options{},
+			Options{Headers: Headers{"X-Api-Version": "2"}, Auth: Auth{Token: "true"}},
+			[]string{},
+		},
 		{"All",
 			Map{"max-frequency": 12, "include-images": true, "ignore-hash": true, "obsolete": 54},
-			Options{MinFreq: 6, InclImages: true, IgnHash: false},
-			Options{MinFreq: 6, InclImages: true, IgnHash: true},
+			Options{MinFreq: Hours(6), InclImages: true, IgnHash: false},
+			Options{MinFreq: Hours(6), InclImages: true, IgnHash: true},
 			[]string{"max-frequency", "obsolete"},
 		},
 	}
 
 	for _, tt := range tests {
 		tst.Run(tt.name, func(tst *testing.T) {
-			out, unk := buildOptions(&tt.opts, tt.inp)
+			out, unk, err := buildOptions(&tt.opts, tt.inp)
+			if err != nil {
+				tst.Fatal(err)
+			}
 
 			if diff := cmp.Diff(tt.out, out); diff != "" {
 				tst.Error(diff)
@@ -62,6 +87,137 @@ func TestBuildOptions(tst *testing.T) {
 	}
 }
 
+func TestFrequency(tst *testing.T) {
+	tests := []struct {
+		name    string
+		inp     string
+		out     Frequency
+		wantErr bool
+	}{
+		{"Hours", "min-frequency: 6", Hours(6), false},
+		{"Hours as String", `min-frequency: "6"`, Hours(6), false},
+		{"Duration", "min-frequency: 15m", Frequency(15 * time.Minute), false},
+		{"Complex Duration", "min-frequency: 1h30m", Frequency(90 * time.Minute), false},
+		{"Zero", "min-frequency: 0", 0, false},
+		{"Negative", "min-frequency: -1", 0, true},
+		{"Invalid", "min-frequency: often", 0, true},
+		{"Float", "min-frequency: 1.5", 0, true},
+	}
+
+	for _, tt := range tests {
+		tst.Run(tt.name, func(tst *testing.T) {
+			var opts Options
+			err := yaml.Unmarshal([]byte(tt.inp), &opts)
+			if (err != nil) != tt.wantErr {
+				tst.Fatalf("yaml: error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && opts.MinFreq != tt.out {
+				tst.Errorf("yaml: Expected %s, got %s", tt.out, opts.MinFreq)
+			}
+
+			var m Map
+			if err := yaml.Unmarshal([]byte(tt.inp), &m); err != nil {
+				tst.Fatal(err)
+			}
+			opts, _, err = buildOptions(&Options{}, m)
+			if (err != nil) != tt.wantErr {
+				tst.Fatalf("buildOptions: error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && opts.MinFreq != tt.out {
+				tst.Errorf("buildOptions: Expected %s, got %s", tt.out, opts.MinFreq)
+			}
+		})
+	}
+}
+
+func TestBuildOptionsKeepsGlobal(tst *testing.T) {
+	global := Options{
+		Headers:      Headers{"Accept": "*/*"},
+		FetchWindows: []string{"Mon-Fri", "Sat 8-12"},
+		TLS:          TLS{CA: "ca.pem", Pins: []string{"a", "b"}},
+	}
+	out, _, err := buildOptions(&global, Map{
+		"headers":       Map{"X-Foo": "bar"},
+		"fetch-windows": []any{"Sun"},
+		"tls":           Map{"pins": []any{"c"}},
+	})
+	if err != nil {
+		tst.Fatal(err)
+	}
+
+	want := Options{
+		Headers:      Headers{"X-Foo": "bar"},
+		FetchWindows: []string{"Sun"},
+		TLS:          TLS{CA: "ca.pem", Pins: []string{"c"}},
+	}
+	if diff := cmp.Diff(want, out); diff != "" {
+		tst.Error(diff)
+	}
+
+	if diff := cmp.Diff(Options{
+		Headers:      Headers{"Accept": "*/*"},
+		FetchWindows: []string{"Mon-Fri", "Sat 8-12"},
+		TLS:          TLS{CA: "ca.pem", Pins: []string{"a", "b"}},
+	}, global); diff != "" {
+		tst.Error(diff)
+	}
+}
+
+func TestSecret(tst *testing.T) {
+	dir := tst.TempDir()
+	file := filepath.Join(dir, "token")
+	if err := os.WriteFile(file, []byte("from file\n"), 0o600); err != nil {
+		tst.Fatal(err)
+	}
+	tst.Setenv("F2I_TEST_SECRET", "from env")
+
+	tests := []struct {
+		name    string
+		inp     string
+		out     Secret
+		wantErr bool
+	}{
+		{"Plain", "token: plain", "plain", false},
+		{"Number", "token: 123456", "123456", false},
+		{"Bool", "token: true", "true", false},
+		{"Null", "token: ~", "", false},
+		{"File", "token: {file: " + file + "}", "from file", false},
+		{"Missing File", "token: {file: " + filepath.Join(dir, "missing") + "}", "", true},
+		{"Env", "token: {env: F2I_TEST_SECRET}", "from env", false},
+		{"Missing Env", "token: {env: F2I_TEST_NO_SECRET}", "", true},
+		{"Command", "token: {command: echo from command}", "from command", false},
+		{"Command List", "token: {command: [echo, '-n', from command]}", "from command", false},
+		{"Failing Command", "token: {command: [false]}", "", true},
+		{"Unknown Source", "token: {vault: foo}", "", true},
+		{"List", "token: [a, b]", "", true},
+	}
+
+	for _, tt := range tests {
+		tst.Run(tt.name, func(tst *testing.T) {
+			var auth Auth
+			err := yaml.Unmarshal([]byte(tt.inp), &auth)
+			if (err != nil) != tt.wantErr {
+				tst.Fatalf("yaml: error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && auth.Token != tt.out {
+				tst.Errorf("yaml: Expected %q, got %q", tt.out, auth.Token)
+			}
+
+			var m Map
+			if err := yaml.Unmarshal([]byte(tt.inp), &m); err != nil {
+				tst.Fatal(err)
+			}
+			opts, _, err := buildOptions(&Options{}, Map{"auth": m})
+			if (err != nil) != tt.wantErr {
+				tst.Fatalf("buildOptions: error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && opts.Auth.Token != tt.out {
+				tst.Errorf("buildOptions: Expected %q, got %q", tt.out, opts.Auth.Token)
+			}
+		})
+	}
+}
+
 func TestBuildFeeds(tst *testing.T) {
 	tests := []struct {
 		name         string
@@ -88,7 +244,7 @@ func TestBuildFeeds(tst *testing.T) {
 				{Feed: feed{Name: "Dup", Url: "google.de"}},
 				{Feed: feed{Name: "Dup", Url: "bing.de"}},
 			}, result: Feeds{}},
-		{name: "No URL", wantErr: true, errMsg: "Feed 'muh' has not specified a URL or an Exec clause.", target: "",
+		{name: "No URL", wantErr: true, errMsg: "Feed 'muh' has not specified a URL, an Exec, a Scrape, or a Json clause.", target: "",
 			feeds: []configGroupFeed{
 				{Target: n("foo"), Feed: feed{Name: "muh"}},
 			},
@@ -174,18 +330,57 @@ func TestBuildFeeds(tst *testing.T) {
 				"bar": &Feed{Name: "bar", Url: "bing.de", Target: t("INBOX.Feed2")},
 			},
 		},
-		{name: "Mixed URL Targets", wantErr: true, errMsg: "Line 0: Given URL endpoint 'imap://other.bar:443' does not match previous endpoint 'imap://foo.bar:443'.", target: "",
+		{name: "Mixed URL Targets", wantErr: false, target: "",
 			feeds: []configGroupFeed{
 				{Target: n("imap://foo.bar:443/INBOX/Feed"), Feed: feed{Name: "muh", Url: "google.de"}},
 				{Target: n("imap://other.bar:443/INBOX/Feed"), Feed: feed{Name: "bar", Url: "bing.de"}},
+				{Target: n("imap://other.bar:443/INBOX/Feed2"), Feed: feed{Name: "baz", Url: "baz.de"}},
+			},
+			result: Feeds{
+				"muh": &Feed{Name: "muh", Url: "google.de", Target: t("INBOX.Feed")},
+				"bar": &Feed{Name: "bar", Url: "bing.de", Target: t("INBOX.Feed"), Options: Options{Account: "other.bar"}},
+				"baz": &Feed{Name: "baz", Url: "baz.de", Target: t("INBOX.Feed2"), Options: Options{Account: "other.bar"}},
 			},
-			result: Feeds{},
 		},
-		{name: "Maildir URL Target", wantErr: true, errMsg: "Line 0: Maildir is not supported.", target: "",
+		{name: "URL Target on Group", wantErr: false, target: "",
 			feeds: []configGroupFeed{
-				{Target: n("maildir:///home/foo/INBOX/Feed"), Feed: feed{Name: "muh"}},
+				{Target: n("imap://foo.bar:443/INBOX/Feed"), Feed: feed{Name: "muh", Url: "google.de"}},
+				{Target: n("imap://other.bar:443/INBOX"), Group: group{Group: "G1", Feeds: []configGroupFeed{
+					{Feed: feed{Name: "F1", Url: "F1"}},
+				}}},
+			},
+			result: Feeds{
+				"muh": &Feed{Name: "muh", Url: "google.de", Target: t("INBOX.Feed")},
+				"F1":  &Feed{Name: "F1", Url: "F1", Target: t("INBOX.F1"), Options: Options{Account: "other.bar"}},
+			},
+		},
+		{name: "Account", wantErr: false, target: "",
+			feeds: []configGroupFeed{
+				{Feed: feed{Name: "muh", Url: "google.de"}, Options: Map{"account": "work"}},
+				{Group: group{Group: "G1", Feeds: []configGroupFeed{
+					{Feed: feed{Name: "F1", Url: "F1"}},
+				}}, Options: Map{"account": "private"}},
+			},
+			result: Feeds{
+				"muh": &Feed{Name: "muh", Url: "google.de", Target: t("muh"), Options: Options{Account: "work"}},
+				"F1":  &Feed{Name: "F1", Url: "F1", Target: t("G1.F1"), Options: Options{Account: "private"}},
+			},
+		},
+		{name: "Maildir URL Target", wantErr: false, target: "",
+			feeds: []configGroupFeed{
+				{Target: n("maildir:///home/foo/INBOX/Feed"), Feed: feed{Name: "muh", Url: "google.de"}},
+			},
+			result: Feeds{"muh": &Feed{Name: "muh", Url: "google.de", Target: t("home.foo.INBOX.Feed")}},
+		},
+		{name: "Mixed Maildir and IMAP URL Targets", wantErr: false, target: "",
+			feeds: []configGroupFeed{
+				{Target: n("maildir:///home/foo/INBOX/Feed"), Feed: feed{Name: "muh", Url: "google.de"}},
+				{Target: n("imap://foo.bar:443/INBOX/Feed"), Feed: feed{Name: "bar", Url: "bing.de"}},
+			},
+			result: Feeds{
+				"muh": &Feed{Name: "muh", Url: "google.de", Target: t("home.foo.INBOX.Feed")},
+				"bar": &Feed{Name: "bar", Url: "bing.de", Target: t("INBOX.Feed"), Options: Options{Account: "foo.bar"}},
 			},
-			result: Feeds{},
 		},
 		{name: "Empty Group", wantErr: false, target: "",
 			feeds: []configGroupFeed{
@@ -257,7 +452,7 @@ func TestBuildFeeds(tst *testing.T) {
 			var feeds = Feeds{}
 			var opts = Options{}
 			var globalTarget = Url{}
-			err := buildFeeds(tt.feeds, t(tt.target), feeds, &opts, !tt.noAutoTarget, &globalTarget)
+			err := buildFeeds(tt.feeds, t(tt.target), feeds, &opts, !tt.noAutoTarget, &globalTarget, Accounts{})
 			if tt.wantErr {
 				if err == nil {
 					tst.Error("Excepted error, but was successfull.")
@@ -308,7 +503,7 @@ func TestUnmarshal(tst *testing.T) {
 			inp: "whatever: 2\ntimeout: 60\noptions:\n  min-frequency: 6", wantErr: false, config: func() config {
 				c := defaultConfig(nil, Map{"whatever": 2})
 				c.Timeout = 60
-				c.FeedOptions.MinFreq = 6
+				c.FeedOptions.MinFreq = Hours(6)
 				return c
 			}()},
 		{name: "Known config with invalid feed-options",
@@ -494,6 +689,16 @@ feeds:
        feeds:
         - name: F7
           url: F7
+  - name: Scraped
+    scrape:
+      url: https://example.net/news
+      item: article
+      link: h2 a@href
+  - name: Api
+    json:
+      url: https://example.net/api/posts
+      items: data.posts
+      link: "'https://example.net/posts/' + slug"
 `
 	res := Feeds{
 		"Foo": &Feed{Name: "Foo", Target: t("Foo"), Url: "whatever"},
@@ -504,6 +709,10 @@ feeds:
 		"F5":  &Feed{Name: "F5", Target: t("target"), Url: "F5"},
 		"F6":  &Feed{Name: "F6", Target: t("target"), Url: "F6"},
 		"F7":  &Feed{Name: "F7", Target: t("target.G4.F7"), Url: "F7"},
+		"Scraped": &Feed{Name: "Scraped", Target: t("Scraped"),
+			Scrape: &Scrape{Url: "https://example.net/news", Item: "article", Link: "h2 a@href"}},
+		"Api": &Feed{Name: "Api", Target: t("Api"),
+			Json: &JsonApi{Url: "https://example.net/api/posts", Items: "data.posts", Link: "'https://example.net/posts/' + slug"}},
 	}
 
 	c := WithDefault()
@@ -579,16 +788,154 @@ feeds:
     url: Foo
     target: imaps://other.bar/INBOX/Feeds
 `
-	errorText := "Line 6: Given URL endpoint 'imaps://other.bar:993' does not match previous endpoint 'imaps://foo.bar:993'."
+	res := Feeds{
+		"Foo": &Feed{Name: "Foo", Url: "Foo", Target: t("INBOX.Feeds"), Options: Options{Account: "other.bar"}},
+	}
+
+	c := WithDefault()
+	c.FeedOptions = Options{}
+
+	if err := c.parse(strings.NewReader(inp)); err != nil {
+		tst.Error(err)
+	} else {
+		if diff := cmp.Diff(res, c.Feeds); diff != "" {
+			tst.Error(diff)
+		}
+		if diff := cmp.Diff("imaps://other.bar:993", c.Accounts["other.bar"].String()); diff != "" {
+			tst.Error(diff)
+		}
+	}
+}
+
+func TestAccounts(tst *testing.T) {
+	inp := `
+target: imaps://foo.bar/INBOX/Feeds
+accounts:
+  work:
+    host: work.example
+    port: 993
+    root: Feeds
+  local: maildir:///home/foo/Mail
+feeds:
+  - name: Foo
+    url: Foo
+  - name: Bar
+    url: Bar
+    account: work
+  - group: Local
+    account: local
+    feeds:
+      - name: Baz
+        url: Baz
+`
+	res := Feeds{
+		"Foo": &Feed{Name: "Foo", Url: "Foo", Target: t("Foo")},
+		"Bar": &Feed{Name: "Bar", Url: "Bar", Target: t("Bar"), Options: Options{Account: "work"}},
+		"Baz": &Feed{Name: "Baz", Url: "Baz", Target: t("Local.Baz"), Options: Options{Account: "local"}},
+	}
+
 	c := WithDefault()
 	c.FeedOptions = Options{}
 
-	err := c.parse(strings.NewReader(inp))
-	if err == nil {
-		tst.Error("Expected error.")
+	if err := c.parse(strings.NewReader(inp)); err != nil {
+		tst.Fatal(err)
+	}
+	if diff := cmp.Diff(res, c.Feeds); diff != "" {
+		tst.Error(diff)
+	}
+	if err := c.Validate(); err != nil {
+		tst.Error(err)
+	}
+
+	for name, str := range map[string]string{"": "imaps://foo.bar:993/INBOX/Feeds", "work": "imaps://work.example:993/Feeds", "local": "maildir:///home/foo/Mail"} {
+		if url, ok := c.AccountUrl(name); !ok {
+			tst.Errorf("Account '%s' not found", name)
+		} else if diff := cmp.Diff(str, url.String()); diff != "" {
+			tst.Error(diff)
+		}
+	}
+
+	c.Feeds["Bar"].Account = "unknown"
+	if err := c.Validate(); err == nil {
+		tst.Error("Expected error for unknown account")
+	}
+}
+
+func TestMaildirURLFeedWithoutGlobalTarget(tst *testing.T) {
+	inp := `
+feeds:
+  - name: Foo
+    url: Foo
+    target: maildir:///home/foo/Mail/.feeds.foo
+`
+	res := Feeds{
+		"Foo": &Feed{Name: "Foo", Url: "Foo", Target: []string{"home", "foo", "Mail", ".feeds.foo"}},
+	}
+
+	c := WithDefault()
+	c.FeedOptions = Options{}
+
+	if err := c.parse(strings.NewReader(inp)); err != nil {
+		tst.Error(err)
 	} else {
-		if diff := cmp.Diff(errorText, err.Error()); diff != "" {
+		if diff := cmp.Diff(res, c.Feeds); diff != "" {
+			tst.Error(diff)
+		}
+		if diff := cmp.Diff("maildir:///", c.Target.String()); diff != "" {
 			tst.Error(diff)
 		}
+		if diff := cmp.Diff(LayoutNested, c.Target.Layout); diff != "" {
+			tst.Error(diff)
+		}
+	}
+}
+
+func TestImageCacheHome(tst *testing.T) {
+	home := tst.TempDir()
+	tst.Setenv("HOME", home)
+
+	c := WithDefault()
+	if err := c.parse(strings.NewReader("image-cache: ~/images")); err != nil {
+		tst.Fatal(err)
+	}
+	if want := filepath.Join(home, "images"); c.ImageCache != want {
+		tst.Errorf("Expected %q, got %q", want, c.ImageCache)
+	}
+}
+
+func TestUrlAccount(tst *testing.T) {
+	parse := func(s string) Url {
+		var u Url
+		if err := yaml.Unmarshal([]byte(s), &u); err != nil {
+			tst.Fatal(err)
+		}
+		return u
+	}
+
+	global := parse("imaps://foo.bar/INBOX")
+	accounts := Accounts{
+		"b": parse("imaps://me@other.bar/INBOX"),
+		"a": parse("imaps://me@other.bar/Feeds"),
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"Global", "imaps://foo.bar/INBOX/Feed", ""},
+		{"Existing", "imaps://me@other.bar/Feed", "a"},
+		{"New", "imaps://third.bar/Feed", "third.bar"},
+		{"New with User", "imaps://me@third.bar/Feed", "me@third.bar"},
+		{"New on other Port", "imap://third.bar/Feed", "third.bar (2)"},
+		{"Created before", "imaps://third.bar/Other", "third.bar"},
+	}
+
+	for _, tt := range tests {
+		tst.Run(tt.name, func(tst *testing.T) {
+			if got := urlAccount(parse(tt.url), &global, accounts); got != tt.want {
+				tst.Errorf("Expected account '%s', got '%s'", tt.want, got)
+			}
+		})
 	}
 }
@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 )
@@ -29,6 +30,13 @@ func SetDebug() {
 	level = debug
 }
 
+// SetOutput redirects all non-error output, which goes to stdout by default.
+func SetOutput(w io.Writer) {
+	debugLogger.SetOutput(w)
+	verboseLogger.SetOutput(w)
+	warnLogger.SetOutput(w)
+}
+
 func IsDebug() bool {
 	return level == debug
 }
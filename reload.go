@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Necoro/feed2imap-go/internal/feed/cache"
+	"github.com/Necoro/feed2imap-go/internal/http"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// reloadOnHangup reloads the configuration into state whenever SIGHUP is received. On success, apply is called
+// with the new configuration and the resulting changes.
+// The returned function stops watching for the signal; it waits for a running reload to finish.
+func reloadOnHangup(state *cache.State, apply func(*config.Config, cache.Changes)) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			case <-hup:
+				reloadConfig(state, apply)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(quit)
+		<-done
+	}
+}
+
+func reloadConfig(state *cache.State, apply func(*config.Config, cache.Changes)) {
+	log.Printf("Received SIGHUP, reloading configuration from %s", cfgFile)
+
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		log.Errorf("Reloading configuration: %s. Keeping the old one.", err)
+		return
+	}
+
+	changes, err := state.Reload(cfg)
+	if err != nil {
+		log.Errorf("Reloading configuration: %s. Keeping the old one.", err)
+		return
+	}
+
+	http.SetLimits(cfg.MaxFetches, cfg.MaxPerHost)
+	if err = loadTemplates(cfg); err != nil {
+		log.Errorf("Reloading templates: %s", err)
+	}
+
+	log.Printf("Reloaded configuration: %d feeds added, %d changed, %d removed.",
+		len(changes.Added), len(changes.Changed), len(changes.Removed))
+	logFeeds("Added", changes.Added)
+	logFeeds("Changed", changes.Changed)
+	logFeeds("Removed", changes.Removed)
+
+	apply(cfg, changes)
+}
+
+func logFeeds(what string, names []string) {
+	if len(names) > 0 {
+		log.Printf("%s feeds: %s", what, strings.Join(names, ", "))
+	}
+}
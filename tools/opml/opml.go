@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Necoro/feed2imap-go/internal/opml"
+	"github.com/Necoro/feed2imap-go/pkg/config"
+	"github.com/Necoro/feed2imap-go/pkg/log"
+)
+
+// flags
+var (
+	cfgFile string = "config.yml"
+	outFile string = ""
+	verbose bool   = false
+)
+
+func init() {
+	flag.StringVar(&cfgFile, "f", cfgFile, "configuration file")
+	flag.StringVar(&outFile, "o", outFile, "output file (default: stdout)")
+	flag.BoolVar(&verbose, "v", verbose, "enable verbose output")
+
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		_, _ = fmt.Fprintf(out, "Usage: %s [options] export\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "       %s [options] import FILE.opml\n\n", os.Args[0])
+		_, _ = fmt.Fprintln(out, "export: Write the feeds of the configuration as OPML.")
+		_, _ = fmt.Fprintln(out, "import: Write the feeds of the OPML file, that are not yet part of the configuration, as YAML.")
+		_, _ = fmt.Fprintln(out, "        The result is meant to be merged into the 'feeds' section of the configuration.")
+		_, _ = fmt.Fprintln(out, "\nOptions:")
+		flag.PrintDefaults()
+	}
+}
+
+func output() (io.WriteCloser, error) {
+	if outFile == "" {
+		return os.Stdout, nil
+	}
+	return os.Create(outFile)
+}
+
+func export(cfg *config.Config) error {
+	out, err := output()
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return opml.Export(cfg).Write(out)
+}
+
+func importFile(cfg *config.Config, file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	doc, err := opml.Read(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := output()
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := opml.Import(doc, cfg.Feeds, out)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Imported %d feeds.\n", n)
+	return nil
+}
+
+func run() error {
+	flag.Parse()
+
+	// stdout might be used for the result
+	log.SetOutput(os.Stderr)
+	if verbose {
+		log.SetVerbose()
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "export" && len(args) == 1:
+		return export(cfg)
+	case args[0] == "import" && len(args) == 2:
+		return importFile(cfg, args[1])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+}